@@ -1,8 +1,9 @@
 module github.com/qri-io/mkpkg
 
-go 1.12
+go 1.20
 
 require (
 	github.com/ghodss/yaml v1.0.0
-	gopkg.in/yaml.v2 v2.2.2 // indirect
+	github.com/klauspost/compress v1.17.8
+	gopkg.in/yaml.v2 v2.2.2
 )
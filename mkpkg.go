@@ -1,66 +1,573 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/qri-io/mkpkg/mkpkg"
+	"github.com/qri-io/mkpkg/mkpkg/bom"
+	"github.com/qri-io/mkpkg/mkpkg/xar"
 )
 
-var (
-	cfg   string
-	os    string
-	blank bool
-)
+const helpText = `mkpkg creates installer packages for a distributable binary
 
-func init() {
-	flag.BoolVar(&blank, "blank", false, "print blank YAML configuration file")
-	flag.StringVar(&cfg, "config", "", "path to config.yaml file")
-	flag.StringVar(&os, "os", "", "operating system to create package for. One of: darwin,windows,linux")
-}
+usage:
+  mkpkg <command> [flags]
+
+commands:
+  init      write a blank configuration file to edit
+  validate  check a configuration file for problems
+  build     create packages
+  inspect   list package formats, the packages a configuration creates, or
+            the contents of a .pkg or Bom file
+  blank     print a blank configuration file
 
-const helpText = `
-mkpkg creates installer packages for a distributable binary
+run "mkpkg <command> -h" for command flags
 `
 
+// exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1
+	// invalid flags, commands, or values
+	exitUsage = 2
+)
+
 func main() {
-	flag.Parse()
-	if blank {
-		fmt.Print(blankFile)
-		return
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command named by args, returning an exit code
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, helpText)
+		return exitUsage
+	}
+
+	if name := args[0]; strings.HasPrefix(name, "-") && name != "-h" && name != "-help" && name != "--help" {
+		args = legacyCommand(args)
 	}
+	name := args[0]
 
-	if cfg == "" {
-		fmt.Println(helpText)
-		flag.PrintDefaults()
-		return
+	switch name {
+	case "init":
+		return initCmd(args[1:])
+	case "validate":
+		return validateCmd(args[1:])
+	case "build":
+		return buildCmd(args[1:])
+	case "inspect":
+		return inspectCmd(args[1:])
+	case "blank":
+		return blankCmd(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(helpText)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %q\n%s", name, helpText)
+		return exitUsage
 	}
+}
 
-	data, err := ioutil.ReadFile(cfg)
+// legacyCommand maps flags given without a command to a command, as mkpkg
+// took before it had commands. -blank & -validate select their commands,
+// anything else builds, eg: mkpkg -config config.yaml -os darwin
+func legacyCommand(args []string) []string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		switch strings.TrimLeft(arg, "-") {
+		case "blank", "blank=true":
+			// -blank printed the blank config whatever else was given
+			return []string{"blank"}
+		case "validate", "validate=true":
+			return append(append([]string{"validate"}, args[:i]...), args[i+1:]...)
+		}
+	}
+	return append([]string{"build"}, args...)
+}
+
+// newFlagSet creates flags for a command. use parseFlags to parse them
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: mkpkg %s [flags]\n\n%s\n\nflags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses a command's flags, allowing at most maxArgs arguments
+// after them. ok is false if the command should exit with code instead of
+// running, because -h was given or the flags are invalid. invalid flags are
+// reported as JSON if -json is among args
+func parseFlags(fs *flag.FlagSet, args []string, maxArgs int) (code int, ok bool) {
+	asJSON := jsonRequested(args)
+	if asJSON {
+		fs.SetOutput(ioutil.Discard)
+	}
+	err := fs.Parse(args)
+	switch {
+	case err == flag.ErrHelp:
+		if asJSON {
+			fs.SetOutput(os.Stderr)
+			fs.Usage()
+		}
+		return exitOK, false
+	case err != nil && !asJSON:
+		// the flag set has already printed the error & usage
+		return exitUsage, false
+	case err != nil:
+		return result(asJSON, map[string]interface{}{}, usageError{err}, exitUsage), false
+	case fs.NArg() > maxArgs:
+		err = fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args()[maxArgs:], " "))
+		return result(asJSON, map[string]interface{}{}, usageError{err}, exitUsage), false
+	}
+	return exitOK, true
+}
+
+// jsonRequested reports if args include -json, before flags are parsed
+func jsonRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		switch strings.TrimLeft(arg, "-") {
+		case "json", "json=true", "json=1":
+			return true
+		}
+	}
+	return false
+}
+
+// result reports the outcome of a command, as JSON on stdout if asJSON is
+// set. otherwise err is written to stderr
+func result(asJSON bool, v map[string]interface{}, err error, code int) int {
+	if asJSON {
+		if err != nil {
+			v["error"] = err.Error()
+		}
+		data, merr := json.MarshalIndent(v, "", "  ")
+		if merr != nil {
+			fmt.Fprintf(os.Stderr, "error encoding json: %s\n", merr)
+			return exitFailure
+		}
+		fmt.Println(string(data))
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	}
+	if err != nil && code == exitOK {
+		return exitFailure
+	}
+	return code
+}
+
+// usageError is an error caused by invalid flags or values
+type usageError struct{ error }
+
+// exitCode returns the exit status for err
+func exitCode(err error) int {
+	switch err.(type) {
+	case nil:
+		return exitOK
+	case usageError:
+		return exitUsage
+	default:
+		return exitFailure
+	}
+}
+
+// loadConfig reads a Package from a YAML configuration file
+func loadConfig(path string) (mkpkg.Package, error) {
+	p := mkpkg.Package{}
+	if path == "" {
+		return p, usageError{fmt.Errorf("-config is required")}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return p, fmt.Errorf("reading config file: %s", err)
+	}
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("decoding yaml file: %s", err)
+	}
+	return p, nil
+}
+
+// targetFlags select the packages a command works with
+type targetFlags struct {
+	goos, format string
+	all          bool
+}
+
+func (t *targetFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.goos, "os", "", "operating system to create package for. One of: "+strings.Join(mkpkg.BuilderTargets(), ","))
+	fs.StringVar(&t.format, "format", "", "package format to create. default is the os' default format, see mkpkg inspect")
+	fs.BoolVar(&t.all, "all", false, "create every format for every os & arch in the config's Targets")
+}
+
+// jobs lists the packages selected by flags. with neither -os nor -all, the
+// config's Targets are used if orTargets is set
+func (t targetFlags) jobs(p mkpkg.Package, orTargets bool) ([]mkpkg.Job, error) {
+	if t.all || (t.goos == "" && orTargets && len(p.Targets) > 0) {
+		jobs, err := p.Jobs()
+		if err != nil {
+			return nil, usageError{err}
+		}
+		return jobs, nil
+	}
+	if t.goos == "" {
+		return nil, usageError{fmt.Errorf("one of -os or -all is required")}
+	}
+
+	b, err := mkpkg.LookupBuilder(t.goos, t.format)
 	if err != nil {
-		fmt.Printf("error reading config file: %s\n", err.Error())
-		return
+		return nil, usageError{err}
 	}
+	target := mkpkg.Target{OS: t.goos}
+	tp, err := p.ForTarget(target)
+	if err != nil {
+		return nil, usageError{err}
+	}
+	return []mkpkg.Job{{Target: target, Package: tp, Builder: b}}, nil
+}
 
-	r := mkpkg.Package{}
-	if err := yaml.Unmarshal(data, &r); err != nil {
-		fmt.Printf("error decoding yaml file: %s\n", err.Error())
-		return
+func initCmd(args []string) int {
+	fs := newFlagSet("init", "write a blank configuration file to edit")
+	cfg := fs.String("config", "config.yaml", "path to write the configuration file to")
+	force := fs.Bool("force", false, "overwrite an existing configuration file")
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	if code, ok := parseFlags(fs, args, 0); !ok {
+		return code
 	}
 
-	switch os {
-	case "darwin":
-		if err := r.MakeDarwin(); err != nil {
-			fmt.Printf("error creating darwin package: %s\n", err.Error())
-			return
+	res := map[string]interface{}{"config": *cfg}
+	if _, err := os.Stat(*cfg); err == nil && !*force {
+		return result(*asJSON, res, fmt.Errorf("%s already exists. use -force to overwrite it", *cfg), exitFailure)
+	}
+	if err := ioutil.WriteFile(*cfg, []byte(blankFile), 0644); err != nil {
+		return result(*asJSON, res, err, exitFailure)
+	}
+	if !*asJSON {
+		fmt.Printf("wrote %s. edit it to taste, then run: mkpkg build -all -config %s\n", *cfg, *cfg)
+	}
+	return result(*asJSON, res, nil, exitOK)
+}
+
+func blankCmd(args []string) int {
+	fs := newFlagSet("blank", "print a blank YAML configuration file")
+	if code, ok := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+	fmt.Print(blankFile)
+	return exitOK
+}
+
+func validateCmd(args []string) int {
+	fs := newFlagSet("validate", "check a configuration file for problems. checks the config's Targets unless -os is given")
+	cfg := fs.String("config", "", "path to config.yaml file")
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	var t targetFlags
+	t.register(fs)
+	if code, ok := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+
+	res := map[string]interface{}{"config": *cfg}
+	p, err := loadConfig(*cfg)
+	if err != nil {
+		return result(*asJSON, res, err, exitCode(err))
+	}
+	problems := append([]string{}, p.Problems()...)
+	if t.goos != "" || t.all || len(p.Targets) > 0 {
+		jobs, err := t.jobs(p, true)
+		if err != nil && t.goos != "" {
+			return result(*asJSON, res, err, exitCode(err))
+		} else if err != nil {
+			problems = append(problems, err.Error())
+		}
+		for _, j := range jobs {
+			problems = append(problems, j.Problems()...)
+		}
+	}
+
+	res["valid"] = len(problems) == 0
+	res["problems"] = problems
+	if !*asJSON {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s is valid\n", *cfg)
+		}
+	}
+	if len(problems) > 0 {
+		return result(*asJSON, res, fmt.Errorf("%s has %d problem(s)", *cfg, len(problems)), exitFailure)
+	}
+	return result(*asJSON, res, nil, exitOK)
+}
+
+// formatInfo describes a registered package format
+type formatInfo struct {
+	OS        string `json:"os"`
+	Format    string `json:"format"`
+	Default   bool   `json:"default"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// jobInfo describes a package a configuration creates
+type jobInfo struct {
+	OS      string `json:"os"`
+	Arch    string `json:"arch,omitempty"`
+	Format  string `json:"format"`
+	BinPath string `json:"binPath,omitempty"`
+}
+
+// fileInfo describes a file within an inspected archive
+type fileInfo struct {
+	Name     string `json:"name"`
+	Mode     string `json:"mode"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func inspectCmd(args []string) int {
+	fs := newFlagSet("inspect", "list package formats, and the packages a configuration creates if -config is given.\ngiven a file argument, list the contents of a darwin .pkg, xar archive, or Bom file instead")
+	cfg := fs.String("config", "", "path to config.yaml file")
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	var t targetFlags
+	t.register(fs)
+	if code, ok := parseFlags(fs, args, 1); !ok {
+		return code
+	}
+	if fs.NArg() == 1 {
+		return inspectFile(fs.Arg(0), *asJSON)
+	}
+
+	// availability depends on configuration, eg: the MSI backend
+	var p mkpkg.Package
+	if *cfg != "" {
+		var err error
+		if p, err = loadConfig(*cfg); err != nil {
+			return result(*asJSON, map[string]interface{}{}, err, exitCode(err))
+		}
+	}
+
+	var formats []formatInfo
+	for _, b := range mkpkg.Builders() {
+		f := formatInfo{OS: b.Target(), Format: b.Name(), Available: true}
+		f.Default = len(formats) == 0 || formats[len(formats)-1].OS != f.OS
+		if err := b.Available(p); err != nil {
+			f.Available, f.Reason = false, err.Error()
+		}
+		formats = append(formats, f)
+	}
+	res := map[string]interface{}{"formats": formats}
+
+	var jobs []jobInfo
+	if *cfg != "" {
+		list, err := t.jobs(p, true)
+		if err != nil {
+			return result(*asJSON, res, err, exitCode(err))
+		}
+		for _, j := range list {
+			jobs = append(jobs, jobInfo{OS: j.Target.OS, Arch: j.Target.Arch, Format: j.Builder.Name(), BinPath: j.BinPath()})
+		}
+		res["jobs"] = jobs
+	}
+
+	if !*asJSON {
+		fmt.Println("formats:")
+		for _, f := range formats {
+			note := ""
+			if f.Default {
+				note = " (default)"
+			}
+			if !f.Available {
+				note += " unavailable: " + f.Reason
+			}
+			fmt.Printf("  %s: %s%s\n", f.OS, f.Format, note)
+		}
+		if *cfg != "" {
+			fmt.Printf("\n%s creates:\n", *cfg)
+			for _, j := range jobs {
+				from := ""
+				if j.BinPath != "" {
+					from = " from " + j.BinPath
+				}
+				fmt.Printf("  %s %s%s\n", mkpkg.Target{OS: j.OS, Arch: j.Arch}, j.Format, from)
+			}
+		}
+	}
+	return result(*asJSON, res, nil, exitOK)
+}
+
+// inspectFile lists the contents of a xar archive, such as a darwin .pkg, and
+// the bills of materials within it, or of a single Bom file
+func inspectFile(path string, asJSON bool) int {
+	res := map[string]interface{}{"file": path}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return result(asJSON, res, err, exitFailure)
+	}
+
+	boms := map[string][]byte{}
+	var files []fileInfo
+	switch {
+	case bytes.HasPrefix(data, []byte("xar!")):
+		r, err := xar.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return result(asJSON, res, err, exitFailure)
+		}
+		for _, f := range r.File {
+			files = append(files, fileInfo{Name: f.Name, Mode: f.Mode.String(), Size: f.Size, Checksum: f.ExtractedChecksum})
+			if f.Name == "Bom" || strings.HasSuffix(f.Name, "/Bom") {
+				if boms[f.Name], err = f.ReadAll(); err != nil {
+					return result(asJSON, res, fmt.Errorf("reading %s: %s", f.Name, err), exitFailure)
+				}
+			}
+		}
+		res["files"] = files
+	case bytes.HasPrefix(data, []byte("BOMStore")):
+		boms[filepath.Base(path)] = data
+	default:
+		return result(asJSON, res, fmt.Errorf("%s isn't a xar archive or Bom file", path), exitFailure)
+	}
+
+	bomEntries := map[string][]string{}
+	var bomNames []string
+	for name, data := range boms {
+		entries, err := bom.Read(data)
+		if err != nil {
+			return result(asJSON, res, fmt.Errorf("reading %s: %s", name, err), exitFailure)
+		}
+		// entries are listed the way lsbom prints them
+		lines := []string{}
+		for _, e := range entries {
+			lines = append(lines, e.String())
+		}
+		bomEntries[name] = lines
+		bomNames = append(bomNames, name)
+	}
+	sort.Strings(bomNames)
+	res["boms"] = bomEntries
+
+	if !asJSON {
+		if files != nil {
+			fmt.Printf("%s files:\n", path)
+			for _, f := range files {
+				fmt.Printf("  %s\t%s\t%d\n", f.Name, f.Mode, f.Size)
+			}
+		}
+		for _, name := range bomNames {
+			fmt.Printf("\n%s:\n", name)
+			for _, line := range bomEntries[name] {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+	}
+	return result(asJSON, res, nil, exitOK)
+}
+
+func buildCmd(args []string) int {
+	fs := newFlagSet("build", "create packages for an os with -os, or every configured target with -all")
+	cfg := fs.String("config", "", "path to config.yaml file")
+	out := fs.String("out", "", "directory to write packages to. overrides the config's OutDir. default is pkg")
+	parallel := fs.Int("j", 0, "number of packages to create at once with -all. default is one per CPU")
+	artifacts := fs.String("artifacts", "", "write a JSON list of created packages to this path, eg: pkg/artifacts.json")
+	homebrew := fs.Bool("homebrew", false, "write a homebrew cask for darwin packages, or a formula for linux tarballs")
+	manifests := fs.Bool("manifests", false, "write winget & chocolatey manifests for windows msi packages, scoop manifests for windows zips, or a nix derivation for linux tarballs")
+	asJSON := fs.Bool("json", false, "print created packages as JSON")
+	var t targetFlags
+	t.register(fs)
+	if code, ok := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+
+	res := map[string]interface{}{}
+	p, err := loadConfig(*cfg)
+	if err != nil {
+		return result(*asJSON, res, err, exitCode(err))
+	}
+	if *out != "" {
+		p.OutDir = *out
+	}
+	jobs, err := t.jobs(p, false)
+	if err != nil {
+		return result(*asJSON, res, err, exitCode(err))
+	}
+
+	results, err := mkpkg.RunJobs(context.Background(), jobs, *parallel)
+	created := []mkpkg.Artifact{}
+	for _, r := range results {
+		if !*asJSON {
+			for _, a := range r {
+				fmt.Printf("created %s\n", a.Path)
+			}
+		}
+		created = append(created, r...)
+	}
+	// manifests describe every architecture of a package, so they're only
+	// written once all packages are created
+	if err == nil {
+		err = postBuild(p, created, *homebrew, *manifests)
+	}
+	res["artifacts"] = created
+	if *artifacts != "" {
+		if werr := mkpkg.WriteArtifacts(*artifacts, created); werr != nil && err == nil {
+			err = fmt.Errorf("writing artifacts: %s", werr)
+		}
+	}
+	return result(*asJSON, res, err, exitCode(err))
+}
+
+// postBuild writes manifests requested by flags for the created packages.
+// each manifest describes the packages of one os, for every architecture
+func postBuild(p mkpkg.Package, created []mkpkg.Artifact, homebrew, manifests bool) error {
+	byOS := map[string][]mkpkg.Artifact{}
+	formats := map[string]bool{}
+	for _, a := range created {
+		byOS[a.OS] = append(byOS[a.OS], a)
+		formats[a.OS+"/"+a.Format] = true
+	}
+
+	for _, m := range []struct {
+		enabled      bool
+		goos, format string
+		name         string
+		make         func([]mkpkg.Artifact) error
+	}{
+		{homebrew, "darwin", "pkg", "homebrew cask", p.MakeHomebrewCask},
+		{homebrew, "linux", "tar.gz", "homebrew formula", p.MakeHomebrewFormula},
+		{manifests, "linux", "tar.gz", "nix derivation", p.MakeNix},
+		{manifests, "windows", "zip", "scoop manifest", p.MakeScoop},
+		{manifests, "windows", "msi", "winget manifest", p.MakeWinget},
+		{manifests, "windows", "msi", "chocolatey package", p.MakeChocolatey},
+	} {
+		if !m.enabled || !formats[m.goos+"/"+m.format] {
+			continue
+		}
+		if err := m.make(byOS[m.goos]); err != nil {
+			return fmt.Errorf("error creating %s: %s", m.name, err)
 		}
-	case "linux":
-		fmt.Printf("linux packages not yet supported.\n")
-	case "windows":
-		fmt.Printf("windows packages not yet supported.\n")
 	}
+	return nil
 }
 
 const blankFile = `Name: "Qri CLI"
@@ -68,6 +575,24 @@ BinName: "qri"
 Identifier: "io.qri.cli"
 Version: "v0.5.0"
 Description: "qri is a web of datasets"
+SiteURL: "https://qri.io"
+License: "GPL-3.0"
+LicensePath: LICENSE
+ReadmePath: readme.md
+OutDir: pkg
+BinPath: "dist/{{ .OS }}_{{ .Arch }}/qri{{ .Ext }}"
+Targets:
+  - OS: darwin
+    Arch: amd64
+  - OS: linux
+    Arch: amd64
+    Formats: [deb, rpm, tar.gz]
+  - OS: linux
+    Arch: arm64
+    Formats: [deb, rpm]
+  - OS: windows
+    Arch: amd64
+    Formats: [msi, zip]
 Darwin:
   WelcomeMsg: |
     The following steps will guide you to installing the qri command line client. Once installed you'll have access to qri from the command line.
@@ -78,4 +603,61 @@ Darwin:
   MinOSXVersion: "10.6.0"
   BgPngPath: assets/darwin/bg.png
   BinPath: /go/bin/qri
+Linux:
+  Maintainer: "Qri, Inc. <sparkle_pony@qri.io>"
+  Prefix: /usr
+  Release: "1"
+  Group: "Applications/Databases"
+  BinPath: /go/bin/linux_amd64/qri
+MSI:
+  Backend: wixl
+  Arch: amd64
+  Manufacturer: "Qri, Inc."
+  UpgradeCode: "{1a4a6bd4-5bc3-4c5c-9a4b-7f0a5e1c2d3e}"
+  InstallDirName: qri
+  ARPContact: "sparkle_pony@qri.io"
+  ARPHelpLink: "https://qri.io/docs"
+  Shortcuts:
+    - Name: "Qri Shell"
+      Description: "Open a command prompt with qri available"
+      Target: "[%ComSpec]"
+      Arguments: "/k qri help"
+  BinPath: /go/bin/windows_amd64/qri.exe
+FreeBSD:
+  OSVersion: "13"
+  Origin: sysutils/qri
+  BinPath: /go/bin/freebsd_amd64/qri
+Homebrew:
+  URL: "https://github.com/qri-io/qri/releases/download/{{ .Version }}/{{ .File }}"
+  TapPath: ../homebrew-qri
+Zip:
+  Arch: amd64
+  BinPath: /go/bin/windows_amd64/qri.exe
+Nix:
+  URL: "https://github.com/qri-io/qri/releases/download/{{ .Version }}/{{ .File }}"
+WindowsManifests:
+  URL: "https://github.com/qri-io/qri/releases/download/{{ .Version }}/{{ .File }}"
+  Publisher: "Qri, Inc."
+  WingetID: Qri.Qri
+  Tags:
+    - qri
+    - datasets
+Snap:
+  Confinement: strict
+  Grade: stable
+  Plugs:
+    - home
+    - network
+Flatpak:
+  Runtime: org.freedesktop.Platform
+  RuntimeVersion: "23.08"
+  SDK: org.freedesktop.Sdk
+  FinishArgs:
+    - --share=network
+    - --filesystem=home
+  Bundle: false
+NSIS:
+  Arch: amd64
+  Publisher: "Qri, Inc."
+  BinPath: /go/bin/windows_amd64/qri.exe
 `
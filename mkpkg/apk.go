@@ -0,0 +1,221 @@
+package mkpkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// apkArchs maps GOARCH values to alpine architecture names
+var apkArchs = map[string]string{
+	"386":      "x86",
+	"amd64":    "x86_64",
+	"arm":      "armv7",
+	"arm64":    "aarch64",
+	"ppc64le":  "ppc64le",
+	"s390x":    "s390x",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+}
+
+// apk packages are a concatenation of gzip streams: an optional signature
+// tar, a control tar holding .PKGINFO, and a data tar with the files to
+// install. the signature covers the compressed control stream, and
+// .PKGINFO records the sha256 of the compressed data stream
+func (p Package) linuxAPK() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := apkArchs[p.Linux.arch()]
+	if !ok {
+		return "", fmt.Errorf("unsupported alpine architecture: %s", p.Linux.arch())
+	}
+
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	binPath := strings.TrimPrefix(filepath.ToSlash(filepath.Join(p.Linux.prefix(), "bin", p.BinName)), "/")
+	data := withParentDirs([]archiveFile{
+		{Name: binPath, Mode: 0755, Body: bin},
+	})
+	dataGz, err := apkSegment(data, false)
+	if err != nil {
+		return "", err
+	}
+
+	pkginfo := p.apkPkgInfo(arch, len(bin), sha256.Sum256(dataGz))
+	controlGz, err := apkSegment([]archiveFile{
+		{Name: ".PKGINFO", Mode: 0644, Body: []byte(pkginfo)},
+	}, true)
+	if err != nil {
+		return "", err
+	}
+
+	var signatureGz []byte
+	if p.Linux.APKSigningKey != "" {
+		if signatureGz, err = apkSignature(p.Linux.APKSigningKey, controlGz); err != nil {
+			return "", err
+		}
+	}
+
+	f, err := os.Create(filepath.Join(outDir, fmt.Sprintf("%s-%s-%s.apk", p.BinName, p.apkVersion(), arch)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, segment := range [][]byte{signatureGz, controlGz, dataGz} {
+		if _, err := f.Write(segment); err != nil {
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// apkVersion returns the package version in alpine's [version]-r[release] form
+func (p Package) apkVersion() string {
+	return fmt.Sprintf("%s-r%s", p.pkgVersion(), p.Linux.release())
+}
+
+// apkPkgInfo generates the contents of a .PKGINFO file
+func (p Package) apkPkgInfo(arch string, binSize int, datahash [32]byte) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# Generated by mkpkg\n")
+	fmt.Fprintf(buf, "pkgname = %s\n", p.BinName)
+	fmt.Fprintf(buf, "pkgver = %s\n", p.apkVersion())
+	fmt.Fprintf(buf, "pkgdesc = %s\n", p.summary())
+	if p.SiteURL != "" {
+		fmt.Fprintf(buf, "url = %s\n", p.SiteURL)
+	}
+	fmt.Fprintf(buf, "builddate = %d\n", time.Now().Unix())
+	fmt.Fprintf(buf, "packager = %s\n", p.maintainer())
+	fmt.Fprintf(buf, "size = %d\n", binSize)
+	fmt.Fprintf(buf, "arch = %s\n", arch)
+	fmt.Fprintf(buf, "origin = %s\n", p.BinName)
+	fmt.Fprintf(buf, "maintainer = %s\n", p.maintainer())
+	fmt.Fprintf(buf, "license = %s\n", p.license())
+	fmt.Fprintf(buf, "datahash = %x\n", datahash)
+	return buf.String()
+}
+
+// apkSegment writes files as a single gzip stream. regular files carry
+// the sha1 checksum apk records in its installed database. cut segments
+// omit the end-of-archive blocks so they can be concatenated with the
+// segment that follows
+func apkSegment(files []archiveFile, cut bool) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	// whole seconds keep pax records limited to checksums
+	now := time.Now().Truncate(time.Second)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.Name,
+			Mode:    f.Mode,
+			ModTime: now,
+			Uname:   "root",
+			Gname:   "root",
+			Format:  tar.FormatPAX,
+		}
+		if f.Dir {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name = strings.TrimSuffix(f.Name, "/") + "/"
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(f.Body))
+			if !cut {
+				hdr.PAXRecords = map[string]string{
+					"APK-TOOLS.checksum.SHA1": fmt.Sprintf("%x", sha1.Sum(f.Body)),
+				}
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if !f.Dir {
+			if _, err := tw.Write(f.Body); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cut {
+		if err := tw.Flush(); err != nil {
+			return nil, err
+		}
+	} else if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// apkSignature signs the compressed control segment with the PEM encoded RSA
+// private key at keyPath, returning a signature segment. apk looks for the
+// matching public key at /etc/apk/keys/[key file name].pub
+func apkSignature(keyPath string, controlGz []byte) ([]byte, error) {
+	key, err := readRSAPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha1.Sum(controlGz)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf(".SIGN.RSA.%s.pub", filepath.Base(keyPath))
+	return apkSegment([]archiveFile{
+		{Name: name, Mode: 0644, Body: sig},
+	}, true)
+}
+
+// readRSAPrivateKey reads a PEM encoded PKCS#1 or PKCS#8 RSA private key
+func readRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: parsing private key: %s", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA private key", path)
+	}
+	return key, nil
+}
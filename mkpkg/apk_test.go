@@ -0,0 +1,135 @@
+package mkpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// splitGzipMembers splits concatenated gzip streams, returning the
+// compressed bytes of each
+func splitGzipMembers(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var members [][]byte
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		start := len(data) - r.Len()
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gr.Multistream(false)
+		if _, err := io.Copy(ioutil.Discard, gr); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, data[start:len(data)-r.Len()])
+	}
+	return members
+}
+
+func TestLinuxAPK(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(filepath.Dir(p.LicensePath), "builder.rsa")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	p.Linux.APKSigningKey = keyPath
+
+	path, err := p.linuxAPK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(path); got != "qri-0.5.0-r1-x86_64.apk" {
+		t.Errorf("package name mismatch: %s", got)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	members := splitGzipMembers(t, data)
+	if len(members) != 3 {
+		t.Fatalf("expected signature, control & data segments, got %d", len(members))
+	}
+	sigGz, controlGz, dataGz := members[0], members[1], members[2]
+
+	// the signature covers the compressed control segment
+	sig := readTarGz(t, sigGz)
+	if len(sig) != 1 || sig[0].Header.Name != ".SIGN.RSA.builder.rsa.pub" {
+		t.Fatalf("signature segment mismatch: %v", tarNames(sig))
+	}
+	digest := sha1.Sum(controlGz)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], sig[0].Body); err != nil {
+		t.Errorf("signature doesn't verify: %s", err)
+	}
+
+	control := readTarGz(t, controlGz)
+	pkginfo := string(tarFile(t, control, ".PKGINFO").Body)
+	for _, line := range []string{
+		"pkgname = qri\n",
+		"pkgver = 0.5.0-r1\n",
+		"pkgdesc = qri is a web of datasets second paragraph\n",
+		"arch = x86_64\n",
+		"license = GPL-3.0\n",
+		fmt.Sprintf("size = %d\n", len(testBin)),
+		fmt.Sprintf("datahash = %x\n", sha256.Sum256(dataGz)),
+	} {
+		if !strings.Contains(pkginfo, line) {
+			t.Errorf(".PKGINFO missing %q:\n%s", line, pkginfo)
+		}
+	}
+
+	files := readTarGz(t, dataGz)
+	if got, want := strings.Join(tarNames(files), ","), "usr/,usr/bin/,usr/bin/qri"; got != want {
+		t.Errorf("data entries mismatch. got: %s, want: %s", got, want)
+	}
+	bin := tarFile(t, files, "usr/bin/qri")
+	if string(bin.Body) != testBin || bin.Header.Mode != 0755 {
+		t.Errorf("binary mismatch. mode: %o body: %q", bin.Header.Mode, bin.Body)
+	}
+	if got, want := bin.Header.PAXRecords["APK-TOOLS.checksum.SHA1"], fmt.Sprintf("%x", sha1.Sum([]byte(testBin))); got != want {
+		t.Errorf("checksum record mismatch. got: %s, want: %s", got, want)
+	}
+}
+
+func TestLinuxAPKUnsigned(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Linux.Arch = "mipsle"
+
+	path, err := p.linuxAPK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := splitGzipMembers(t, data)
+	if len(members) != 2 {
+		t.Fatalf("expected control & data segments, got %d", len(members))
+	}
+	pkginfo := string(tarFile(t, readTarGz(t, members[0]), ".PKGINFO").Body)
+	if !strings.Contains(pkginfo, "arch = mipsel\n") {
+		t.Errorf("expected mipsel arch:\n%s", pkginfo)
+	}
+}
@@ -0,0 +1,118 @@
+package mkpkg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/qri-io/mkpkg/mkpkg/squashfs"
+)
+
+// appImageArchs maps GOARCH values to the architecture names AppImage
+// runtimes are published under
+var appImageArchs = map[string]string{
+	"386":   "i686",
+	"amd64": "x86_64",
+	"arm":   "armhf",
+	"arm64": "aarch64",
+}
+
+// an AppImage is an executable runtime with a squashfs image of an AppDir
+// appended. when run, the runtime mounts the image & executes AppDir/AppRun
+func (p Package) linuxAppImage() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := appImageArchs[p.Linux.arch()]
+	if !ok {
+		return "", fmt.Errorf("unsupported AppImage architecture: %s", p.Linux.arch())
+	}
+	if p.Linux.IconPath == "" {
+		return "", fmt.Errorf("Linux.IconPath is required to create an AppImage")
+	}
+	if p.Linux.AppImageRuntimePath == "" {
+		return "", fmt.Errorf("Linux.AppImageRuntimePath is required to create an AppImage")
+	}
+
+	runtime, err := ioutil.ReadFile(p.Linux.AppImageRuntimePath)
+	if err != nil {
+		return "", err
+	}
+
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return "", err
+	}
+	icon, err := ioutil.ReadFile(p.Linux.IconPath)
+	if err != nil {
+		return "", err
+	}
+	iconName := p.BinName + strings.ToLower(filepath.Ext(p.Linux.IconPath))
+
+	appRun, err := p.execTemplate(appRunTmpl)
+	if err != nil {
+		return "", err
+	}
+
+	// modern AppImage runtimes mount zstd-compressed images
+	appDir := &bytes.Buffer{}
+	sw, err := squashfs.NewWriter(appDir, squashfs.WriterOptions{Compression: squashfs.Zstd})
+	if err != nil {
+		return "", err
+	}
+	files := []struct {
+		name string
+		mode os.FileMode
+		body []byte
+	}{
+		{"AppRun", 0755, []byte(appRun)},
+		{p.BinName + ".desktop", 0644, []byte(p.desktopEntry(p.BinName, p.BinName))},
+		{iconName, 0644, icon},
+		{path.Join("usr/bin", p.BinName), 0755, bin},
+	}
+	for _, f := range files {
+		if err := sw.WriteFile(squashfs.FileHeader{Name: f.name, Mode: f.mode}, f.body); err != nil {
+			return "", err
+		}
+	}
+	if err := sw.Symlink(squashfs.FileHeader{Name: ".DirIcon"}, iconName); err != nil {
+		return "", err
+	}
+	if err := sw.Close(); err != nil {
+		return "", err
+	}
+
+	out := filepath.Join(outDir, fmt.Sprintf("%s-%s-%s.AppImage", p.BinName, p.Version, arch))
+	if err := ioutil.WriteFile(out, append(runtime, appDir.Bytes()...), 0755); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// desktopEntry generates a freedesktop.org .desktop file that runs the
+// command exec, displayed with icon
+func (p Package) desktopEntry(exec, icon string) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "[Desktop Entry]\n")
+	fmt.Fprintf(buf, "Type=Application\n")
+	fmt.Fprintf(buf, "Name=%s\n", p.Name)
+	fmt.Fprintf(buf, "Comment=%s\n", p.summary())
+	fmt.Fprintf(buf, "Exec=%s\n", exec)
+	fmt.Fprintf(buf, "Icon=%s\n", icon)
+	fmt.Fprintf(buf, "Terminal=%t\n", !p.Linux.GUI)
+	fmt.Fprintf(buf, "Categories=%s;\n", strings.Join(p.Linux.desktopCategories(), ";"))
+	return buf.String()
+}
+
+// appRunTmpl runs the binary from wherever the AppImage is mounted
+const appRunTmpl = `#!/bin/sh
+HERE="$(dirname "$(readlink -f "$0")")"
+export PATH="$HERE/usr/bin:$PATH"
+exec "$HERE/usr/bin/{{ .BinName }}" "$@"
+`
@@ -0,0 +1,66 @@
+package mkpkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinuxAppImage(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	dir := filepath.Dir(p.LicensePath)
+
+	if _, err := p.linuxAppImage(); err == nil || !strings.Contains(err.Error(), "IconPath") {
+		t.Errorf("expected IconPath error, got: %v", err)
+	}
+	p.Linux.IconPath = filepath.Join(dir, "readme.md")
+	if _, err := p.linuxAppImage(); err == nil || !strings.Contains(err.Error(), "AppImageRuntimePath") {
+		t.Errorf("expected AppImageRuntimePath error, got: %v", err)
+	}
+
+	runtime := []byte("\x7fELF fake runtime")
+	p.Linux.AppImageRuntimePath = filepath.Join(dir, "runtime-x86_64")
+	if err := ioutil.WriteFile(p.Linux.AppImageRuntimePath, runtime, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path, err := p.linuxAppImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(path); got != "qri-v0.5.0-x86_64.AppImage" {
+		t.Errorf("AppImage name mismatch: %s", got)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, runtime) {
+		t.Fatalf("AppImage doesn't start with the runtime")
+	}
+	image := data[len(runtime):]
+	if len(image) < 96 || string(image[:4]) != "hsqs" {
+		t.Fatalf("runtime isn't followed by a squashfs image")
+	}
+	// zstd compression
+	if compression := binary.LittleEndian.Uint16(image[20:]); compression != 6 {
+		t.Errorf("expected zstd compression, got %d", compression)
+	}
+}
+
+func TestDesktopEntry(t *testing.T) {
+	p := Package{Name: "Qri", Description: "datasets"}
+	entry := p.desktopEntry("qri", "qri")
+	for _, line := range []string{"Name=Qri\n", "Exec=qri\n", "Terminal=true\n", "Categories=Utility;\n"} {
+		if !strings.Contains(entry, line) {
+			t.Errorf("desktop entry missing %q:\n%s", line, entry)
+		}
+	}
+	p.Linux.GUI = true
+	if entry := p.desktopEntry("qri", "qri"); !strings.Contains(entry, "Terminal=false\n") {
+		t.Errorf("GUI apps shouldn't run in a terminal:\n%s", entry)
+	}
+}
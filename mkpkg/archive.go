@@ -0,0 +1,88 @@
+package mkpkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveFile is a single entry in a generated archive
+type archiveFile struct {
+	// slash-separated path of the entry within the archive
+	Name string
+	// permission bits for the entry
+	Mode int64
+	// file contents. ignored for directories
+	Body []byte
+	// true if this entry is a directory
+	Dir bool
+}
+
+// withParentDirs returns files with directory entries added for every
+// parent directory, sorted so parents always precede their children
+func withParentDirs(files []archiveFile) []archiveFile {
+	seen := map[string]bool{}
+	for _, f := range files {
+		if f.Dir {
+			seen[strings.TrimSuffix(f.Name, "/")] = true
+		}
+	}
+
+	all := append([]archiveFile{}, files...)
+	for _, f := range files {
+		for dir := path.Dir(strings.TrimSuffix(f.Name, "/")); dir != "." && dir != "/" && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			all = append(all, archiveFile{Name: dir, Mode: 0755, Dir: true})
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return strings.TrimSuffix(all[i].Name, "/") < strings.TrimSuffix(all[j].Name, "/")
+	})
+	return all
+}
+
+// writeTar writes files as a tar stream to w, owned by root
+func writeTar(w io.Writer, files []archiveFile) error {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.Name,
+			Mode:    f.Mode,
+			ModTime: now,
+			Uname:   "root",
+			Gname:   "root",
+			Format:  tar.FormatGNU,
+		}
+		if f.Dir {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name = strings.TrimSuffix(f.Name, "/") + "/"
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(f.Body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !f.Dir {
+			if _, err := tw.Write(f.Body); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// writeTarGz writes files as a gzip-compressed tar stream to w
+func writeTarGz(w io.Writer, files []archiveFile) error {
+	gw := gzip.NewWriter(w)
+	if err := writeTar(gw, files); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,96 @@
+package mkpkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Artifact is a file created by a Builder
+type Artifact struct {
+	// absolute path to the created file
+	Path string `json:"path"`
+	// package format that created the file, eg: deb
+	Format string `json:"format"`
+	// operating system the file installs on, eg: linux
+	OS string `json:"os"`
+	// architecture the file installs on using go's GOARCH naming, eg: amd64.
+	// empty for packages that aren't architecture specific
+	Arch string `json:"arch,omitempty"`
+	// size of the file in bytes
+	Size int64 `json:"size"`
+	// hex-encoded sha256 of the file
+	SHA256 string `json:"sha256"`
+	// details of the packaged project
+	Package ArtifactPackage `json:"package"`
+}
+
+// ArtifactPackage is the package metadata recorded with an Artifact
+type ArtifactPackage struct {
+	Name        string `json:"name"`
+	BinName     string `json:"binName"`
+	Identifier  string `json:"identifier,omitempty"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+	SiteURL     string `json:"siteURL,omitempty"`
+}
+
+// NewArtifact describes the file at path, created for p. Builders should use
+// NewArtifact to fill in size, checksum & package metadata. Artifacts are
+// always files, NewArtifact returns an error if path is a directory
+func NewArtifact(p Package, path, format, goos, arch string) (Artifact, error) {
+	a := Artifact{
+		Path:   path,
+		Format: format,
+		OS:     goos,
+		Arch:   arch,
+		Package: ArtifactPackage{
+			Name:        p.Name,
+			BinName:     p.BinName,
+			Identifier:  p.Identifier,
+			Version:     p.Version,
+			Description: p.Description,
+			SiteURL:     p.SiteURL,
+		},
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return a, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return a, err
+	}
+	if fi.IsDir() {
+		return a, fmt.Errorf("artifact %s is a directory", path)
+	}
+	h := sha256.New()
+	if a.Size, err = io.Copy(h, f); err != nil {
+		return a, err
+	}
+	a.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return a, nil
+}
+
+// WriteArtifacts writes a list of artifacts as JSON to path, for release
+// tooling to pick up, eg: pkg/artifacts.json
+func WriteArtifacts(path string, artifacts []Artifact) error {
+	if artifacts == nil {
+		artifacts = []Artifact{}
+	}
+	data, err := json.MarshalIndent(artifacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
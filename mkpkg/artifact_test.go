@@ -0,0 +1,115 @@
+package mkpkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNewArtifact(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	a, err := NewArtifact(p, p.Linux.BinPath, "bin", "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Size != int64(len(testBin)) || a.SHA256 != fmt.Sprintf("%x", sha256.Sum256([]byte(testBin))) {
+		t.Errorf("size/checksum mismatch: %d %s", a.Size, a.SHA256)
+	}
+	want := ArtifactPackage{
+		Name:        "Qri CLI",
+		BinName:     "qri",
+		Identifier:  "io.qri.cli",
+		Version:     "v0.5.0",
+		Description: p.Description,
+		SiteURL:     "https://qri.io",
+	}
+	if a.Package != want {
+		t.Errorf("package mismatch: %#v", a.Package)
+	}
+
+	if _, err := NewArtifact(p, filepath.Dir(p.Linux.BinPath), "dir", "linux", ""); err == nil {
+		t.Error("expected an error for a directory")
+	}
+	if _, err := NewArtifact(p, filepath.Join(p.OutDir, "missing"), "bin", "linux", ""); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestWriteArtifacts(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path := filepath.Join(p.OutDir, "artifacts.json")
+	if err := WriteArtifacts(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[]\n" {
+		t.Errorf("expected an empty list, got: %s", data)
+	}
+
+	a, err := NewArtifact(p, p.Linux.BinPath, "bin", "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteArtifacts(path, []Artifact{a}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	var got []Artifact
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != a {
+		t.Errorf("artifacts didn't round trip: %#v", got)
+	}
+}
+
+func TestFlatpakArtifacts(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	b, err := LookupBuilder("linux", "flatpak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err := b.Build(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("expected manifest & metainfo artifacts, got: %#v", artifacts)
+	}
+	for i, name := range []string{"io.qri.cli.json", "io.qri.cli.metainfo.xml"} {
+		a := artifacts[i]
+		if filepath.Base(a.Path) != name || a.SHA256 == "" || a.Size == 0 || a.Arch != "amd64" || a.Format != "flatpak" {
+			t.Errorf("artifact %d mismatch: %#v", i, a)
+		}
+	}
+}
+
+func TestJobRunArch(t *testing.T) {
+	job := Job{
+		Target:  Target{OS: "test"},
+		Builder: fakeBuilder{name: "fake", build: func(context.Context) error { return nil }},
+	}
+	artifacts, err := job.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Arch != runtime.GOARCH {
+		t.Errorf("expected artifacts for the host architecture, got: %#v", artifacts)
+	}
+}
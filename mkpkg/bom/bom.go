@@ -0,0 +1,230 @@
+// Package bom reads and writes apple bill of materials (BOM) files. A BOM
+// records every path, mode, owner, size and checksum in an installer
+// package payload, and is what lsbom and the macOS installer read
+package bom
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry describes a single path recorded in a bill of materials
+type Entry struct {
+	// slash-separated path relative to the install root, "." for the root
+	// and "./"-prefixed otherwise, eg: ./usr/local/bin
+	Path string
+	// permission bits and file type
+	Mode os.FileMode
+	UID  uint32
+	GID  uint32
+	// modification time, with second precision
+	ModTime time.Time
+	// size of regular files, zero for everything else
+	Size uint32
+	// POSIX cksum CRC of regular file contents
+	Checksum uint32
+	// target of symbolic links
+	LinkName string
+}
+
+// String formats the entry the way lsbom prints it
+func (e Entry) String() string {
+	switch {
+	case e.Mode.IsDir():
+		return fmt.Sprintf("%s\t%o\t%d/%d", e.Path, unixMode(e.Mode), e.UID, e.GID)
+	case e.Mode&os.ModeSymlink != 0:
+		return fmt.Sprintf("%s\t%o\t%d/%d\t%d\t%d\t%s", e.Path, unixMode(e.Mode), e.UID, e.GID, e.Size, e.Checksum, e.LinkName)
+	default:
+		return fmt.Sprintf("%s\t%o\t%d/%d\t%d\t%d", e.Path, unixMode(e.Mode), e.UID, e.GID, e.Size, e.Checksum)
+	}
+}
+
+// FromDir creates entries for every path within root, as if root were the
+// install location. Ownership is recorded as root:wheel, which is what
+// pkgbuild records with --ownership recommended
+func FromDir(root string) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." {
+			rel = "./" + rel
+		}
+
+		e := Entry{Path: rel, Mode: info.Mode(), ModTime: info.ModTime().Truncate(time.Second)}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if e.LinkName, err = os.Readlink(p); err != nil {
+				return err
+			}
+			e.Size = uint32(len(e.LinkName))
+			e.Checksum = Cksum([]byte(e.LinkName))
+		case info.Mode().IsRegular():
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			e.Size = uint32(len(data))
+			e.Checksum = Cksum(data)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// unixMode converts a FileMode to unix mode bits, including the file type
+func unixMode(m os.FileMode) uint16 {
+	mode := uint16(m.Perm())
+	switch {
+	case m.IsDir():
+		mode |= 040000
+	case m&os.ModeSymlink != 0:
+		mode |= 0120000
+	case m&os.ModeDevice != 0:
+		mode |= 060000
+	default:
+		mode |= 0100000
+	}
+	if m&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return mode
+}
+
+// fileMode converts unix mode bits to a FileMode
+func fileMode(mode uint16) os.FileMode {
+	m := os.FileMode(mode & 0777)
+	switch mode & 0170000 {
+	case 040000:
+		m |= os.ModeDir
+	case 0120000:
+		m |= os.ModeSymlink
+	case 060000:
+		m |= os.ModeDevice
+	}
+	if mode&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// path types
+const (
+	typeFile = 1
+	typeDir  = 2
+	typeLink = 3
+	typeDev  = 4
+)
+
+func pathType(m os.FileMode) uint8 {
+	switch {
+	case m.IsDir():
+		return typeDir
+	case m&os.ModeSymlink != 0:
+		return typeLink
+	case m&os.ModeDevice != 0:
+		return typeDev
+	default:
+		return typeFile
+	}
+}
+
+// sortEntries orders entries breadth-first, with siblings grouped by the
+// order of their parent and sorted by name. Assigning ids in this order
+// keeps the paths tree ordered by (parent id, name)
+func sortEntries(entries []Entry) []Entry {
+	byDepth := map[int][]Entry{}
+	maxDepth := 0
+	for _, e := range entries {
+		d := 0
+		if e.Path != "." {
+			d = strings.Count(e.Path, "/")
+		}
+		byDepth[d] = append(byDepth[d], e)
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+
+	rank := map[string]int{}
+	sorted := make([]Entry, 0, len(entries))
+	for d := 0; d <= maxDepth; d++ {
+		level := byDepth[d]
+		sort.SliceStable(level, func(i, j int) bool {
+			a, b := level[i].Path, level[j].Path
+			if pa, pb := rank[parent(a)], rank[parent(b)]; pa != pb {
+				return pa < pb
+			}
+			return path.Base(a) < path.Base(b)
+		})
+		for _, e := range level {
+			rank[e.Path] = len(sorted)
+			sorted = append(sorted, e)
+		}
+	}
+	return sorted
+}
+
+// parent returns the path of the directory containing p, keeping the "./"
+// prefix entry paths use
+func parent(p string) string {
+	d := path.Dir(p)
+	if d == "." || strings.HasPrefix(d, "./") {
+		return d
+	}
+	return "./" + d
+}
+
+// cksumTable is the CRC table for the POSIX cksum algorithm
+var cksumTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}()
+
+// Cksum computes the POSIX cksum CRC of data, which is the checksum BOM
+// files record for each file
+func Cksum(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ cksumTable[byte(crc>>24)^b]
+	}
+	for n := len(data); n > 0; n >>= 8 {
+		crc = crc<<8 ^ cksumTable[byte(crc>>24)^byte(n)]
+	}
+	return ^crc
+}
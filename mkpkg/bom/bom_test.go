@@ -0,0 +1,184 @@
+package bom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCksum(t *testing.T) {
+	// values from the POSIX cksum utility
+	if got := Cksum([]byte("hello\n")); got != 3015617425 {
+		t.Errorf("cksum mismatch: %d", got)
+	}
+	if got := Cksum(nil); got != 4294967295 {
+		t.Errorf("empty cksum mismatch: %d", got)
+	}
+}
+
+func TestFromDirRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkpkg-bom-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "usr", "local", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "usr", "local", "bin", "qri"), []byte("hello\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/qri", filepath.Join(dir, "usr", "local", "qri")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := FromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &bytes.Buffer{}
+	if err := Write(data, entries); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, e := range got {
+		lines = append(lines, e.String())
+	}
+	expect := []string{
+		".\t40755\t0/0",
+		"./usr\t40755\t0/0",
+		"./usr/local\t40755\t0/0",
+		"./usr/local/bin\t40755\t0/0",
+		fmt.Sprintf("./usr/local/qri\t120777\t0/0\t7\t%d\tbin/qri", Cksum([]byte("bin/qri"))),
+		"./usr/local/bin/qri\t100755\t0/0\t6\t3015617425",
+	}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Errorf("entries mismatch.\ngot:  %q\nwant: %q", lines, expect)
+	}
+}
+
+func TestWriteReadManyLeaves(t *testing.T) {
+	entries := testEntries(600)
+	data := &bytes.Buffer{}
+	if err := Write(data, entries); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, sortEntries(entries)) {
+		t.Errorf("entries don't round trip across leaves")
+	}
+}
+
+// testEntries creates a root directory holding n files
+func testEntries(n int) []Entry {
+	modTime := time.Unix(1560000000, 0)
+	entries := []Entry{{Path: ".", Mode: os.ModeDir | 0755, ModTime: modTime}}
+	for i := 0; i < n; i++ {
+		body := []byte(fmt.Sprintf("file %d", i))
+		entries = append(entries, Entry{
+			Path:     fmt.Sprintf("./f%04d", i),
+			Mode:     0644,
+			ModTime:  modTime,
+			Size:     uint32(len(body)),
+			Checksum: Cksum(body),
+		})
+	}
+	return entries
+}
+
+// setBlockLength overwrites the length of block i in a BOM's block table
+func setBlockLength(data []byte, i, length uint32) {
+	indexOffset := binary.BigEndian.Uint32(data[16:])
+	binary.BigEndian.PutUint32(data[indexOffset+4+i*8+4:], length)
+}
+
+func TestReadMalformed(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Write(buf, testEntries(600)); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	s := &store{data: valid}
+	indexOffset := binary.BigEndian.Uint32(valid[16:])
+	count := binary.BigEndian.Uint32(valid[indexOffset:])
+	for i := uint32(0); i < count; i++ {
+		off := indexOffset + 4 + i*8
+		s.pointers = append(s.pointers, [2]uint32{binary.BigEndian.Uint32(valid[off:]), binary.BigEndian.Uint32(valid[off+4:])})
+	}
+	// find the branch block at the root of the paths tree
+	branchIdx := count - 1
+	for ; branchIdx > 0; branchIdx-- {
+		b, _ := s.block(branchIdx)
+		if len(b) == 4096 && binary.BigEndian.Uint16(b) == 0 {
+			break
+		}
+	}
+	branch, _ := s.block(branchIdx)
+	firstLeaf := binary.BigEndian.Uint32(branch[12:])
+	secondLeaf := binary.BigEndian.Uint32(branch[12+8:])
+	// find the file blocks holding parent ids & names of the root & a file
+	var rootFile, childFile uint32
+	for i := uint32(1); i < count; i++ {
+		b, _ := s.block(i)
+		switch {
+		case len(b) == 6 && string(b[4:]) == ".\x00":
+			rootFile = i
+		case len(b) == 10 && string(b[4:]) == "f0000\x00":
+			childFile = i
+		}
+	}
+	child, _ := s.block(childFile)
+	rootID := binary.BigEndian.Uint32(child)
+
+	corrupt := func(f func(data []byte)) []byte {
+		data := append([]byte{}, valid...)
+		f(data)
+		return data
+	}
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:600]},
+		{"short forward leaf", corrupt(func(data []byte) { setBlockLength(data, secondLeaf, 2) })},
+		{"forward leaf past end", corrupt(func(data []byte) { setBlockLength(data, secondLeaf, 1<<31) })},
+		{"short branch", corrupt(func(data []byte) { setBlockLength(data, branchIdx, 14) })},
+		{"branch cycle", corrupt(func(data []byte) {
+			b := s.pointers[branchIdx]
+			binary.BigEndian.PutUint32(data[b[0]+12:], branchIdx)
+		})},
+		{"leaf cycle", corrupt(func(data []byte) {
+			b := s.pointers[secondLeaf]
+			binary.BigEndian.PutUint32(data[b[0]+4:], firstLeaf)
+		})},
+		{"parent cycle", corrupt(func(data []byte) {
+			b := s.pointers[rootFile]
+			binary.BigEndian.PutUint32(data[b[0]:], rootID)
+		})},
+		{"index past end", corrupt(func(data []byte) { binary.BigEndian.PutUint32(data[16:], uint32(len(data))) })},
+	}
+	for _, c := range cases {
+		if _, err := Read(c.data); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package bom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// store provides access to the blocks of a BOMStore file
+type store struct {
+	data     []byte
+	pointers [][2]uint32
+	vars     map[string]uint32
+}
+
+// block returns the contents of block i
+func (s *store) block(i uint32) ([]byte, error) {
+	if i == 0 || int(i) >= len(s.pointers) {
+		return nil, fmt.Errorf("bom: invalid block %d", i)
+	}
+	addr, length := s.pointers[i][0], s.pointers[i][1]
+	if uint64(addr)+uint64(length) > uint64(len(s.data)) {
+		return nil, fmt.Errorf("bom: block %d out of range", i)
+	}
+	return s.data[addr : addr+length], nil
+}
+
+// Read parses a BOMStore bill of materials, returning its entries in the
+// order they are stored
+func Read(data []byte) ([]Entry, error) {
+	if len(data) < headerSize || !bytes.HasPrefix(data, []byte("BOMStore")) {
+		return nil, errors.New("bom: not a BOMStore file")
+	}
+	be := binary.BigEndian
+	indexOffset, indexLength := be.Uint32(data[16:]), be.Uint32(data[20:])
+	varsOffset, varsLength := be.Uint32(data[24:]), be.Uint32(data[28:])
+	if uint64(indexOffset)+uint64(indexLength) > uint64(len(data)) || uint64(varsOffset)+uint64(varsLength) > uint64(len(data)) || indexLength < 4 || varsLength < 4 {
+		return nil, errors.New("bom: header offsets out of range")
+	}
+
+	s := &store{data: data, vars: map[string]uint32{}}
+	index := data[indexOffset : indexOffset+indexLength]
+	count := be.Uint32(index)
+	if uint64(count)*8+4 > uint64(len(index)) {
+		return nil, errors.New("bom: block table out of range")
+	}
+	for i := uint32(0); i < count; i++ {
+		s.pointers = append(s.pointers, [2]uint32{be.Uint32(index[4+i*8:]), be.Uint32(index[8+i*8:])})
+	}
+
+	vars := data[varsOffset : varsOffset+varsLength]
+	n, pos := be.Uint32(vars), 4
+	for i := uint32(0); i < n; i++ {
+		if pos+5 > len(vars) || pos+5+int(vars[pos+4]) > len(vars) {
+			return nil, errors.New("bom: vars out of range")
+		}
+		idx, l := be.Uint32(vars[pos:]), int(vars[pos+4])
+		s.vars[string(vars[pos+5:pos+5+l])] = idx
+		pos += 5 + l
+	}
+
+	pathsIdx, ok := s.vars["Paths"]
+	if !ok {
+		return nil, errors.New("bom: missing Paths tree")
+	}
+	tree, err := s.block(pathsIdx)
+	if err != nil {
+		return nil, err
+	}
+	if len(tree) < 21 || string(tree[:4]) != "tree" {
+		return nil, errors.New("bom: invalid Paths tree")
+	}
+
+	// descend to the leftmost leaf, then follow forward links
+	node := be.Uint32(tree[8:])
+	for visited := map[uint32]bool{}; ; {
+		if visited[node] {
+			return nil, errors.New("bom: cycle in paths tree")
+		}
+		visited[node] = true
+		paths, err := s.block(node)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) < 12 {
+			return nil, errors.New("bom: invalid paths block")
+		}
+		if be.Uint16(paths) == 1 {
+			break
+		}
+		if be.Uint16(paths[2:]) == 0 || len(paths) < 20 {
+			return nil, errors.New("bom: empty branch in paths tree")
+		}
+		node = be.Uint32(paths[12:])
+	}
+
+	type named struct {
+		parent uint32
+		name   string
+	}
+	names := map[uint32]named{}
+	var (
+		ids     []uint32
+		entries []Entry
+	)
+	for visited := map[uint32]bool{}; node != 0; {
+		if visited[node] {
+			return nil, errors.New("bom: cycle in paths leaves")
+		}
+		visited[node] = true
+		paths, err := s.block(node)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) < 12 {
+			return nil, errors.New("bom: invalid paths block")
+		}
+		count := int(be.Uint16(paths[2:]))
+		if 12+count*8 > len(paths) {
+			return nil, errors.New("bom: paths block out of range")
+		}
+		for i := 0; i < count; i++ {
+			info1, err := s.block(be.Uint32(paths[12+i*8:]))
+			if err != nil {
+				return nil, err
+			}
+			file, err := s.block(be.Uint32(paths[16+i*8:]))
+			if err != nil {
+				return nil, err
+			}
+			if len(info1) < 8 || len(file) < 5 {
+				return nil, errors.New("bom: invalid path entry")
+			}
+			id := be.Uint32(info1)
+			names[id] = named{parent: be.Uint32(file), name: string(bytes.TrimRight(file[4:], "\x00"))}
+
+			e, err := s.pathInfo(be.Uint32(info1[4:]))
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+			entries = append(entries, e)
+		}
+		node = be.Uint32(paths[4:])
+	}
+
+	// resolve full paths by walking up parent ids
+	for i, id := range ids {
+		var parts []string
+		for visited := map[uint32]bool{}; id != 0; {
+			if visited[id] {
+				return nil, fmt.Errorf("bom: cycle in parents of path id %d", id)
+			}
+			visited[id] = true
+			n, ok := names[id]
+			if !ok {
+				return nil, fmt.Errorf("bom: unknown parent id %d", id)
+			}
+			parts = append([]string{n.name}, parts...)
+			id = n.parent
+		}
+		p := strings.Join(parts, "/")
+		if p != "." && !strings.HasPrefix(p, "./") {
+			p = "./" + p
+		}
+		entries[i].Path = p
+	}
+	return entries, nil
+}
+
+// pathInfo decodes the details of a single path
+func (s *store) pathInfo(i uint32) (Entry, error) {
+	info, err := s.block(i)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(info) < 31 {
+		return Entry{}, errors.New("bom: invalid path info")
+	}
+	be := binary.BigEndian
+	e := Entry{
+		Mode:     fileMode(be.Uint16(info[4:])),
+		UID:      be.Uint32(info[6:]),
+		GID:      be.Uint32(info[10:]),
+		ModTime:  time.Unix(int64(be.Uint32(info[14:])), 0),
+		Size:     be.Uint32(info[18:]),
+		Checksum: be.Uint32(info[23:]),
+	}
+	if info[0] == typeLink {
+		if l := int(be.Uint32(info[27:])); l > 0 && 31+l <= len(info) {
+			e.LinkName = string(bytes.TrimRight(info[31:31+l], "\x00"))
+		}
+	}
+	if info[0] == typeDir {
+		e.Size = 0
+	}
+	return e, nil
+}
@@ -0,0 +1,178 @@
+package bom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path"
+)
+
+// headerSize is the fixed size of a BOMStore header
+const headerSize = 512
+
+// leafSize caps the number of paths stored in a single tree leaf
+const leafSize = 256
+
+// blocks accumulates the numbered blocks of a BOMStore file. block zero is
+// always null
+type blocks struct {
+	list [][]byte
+}
+
+func (b *blocks) add(data []byte) uint32 {
+	if len(b.list) == 0 {
+		b.list = append(b.list, nil)
+	}
+	b.list = append(b.list, data)
+	return uint32(len(b.list) - 1)
+}
+
+// tree adds a tree header pointing at a root paths block
+func (b *blocks) tree(blockSize, pathCount, child uint32) uint32 {
+	return b.add(encode("tree", uint32(1), child, blockSize, pathCount, uint8(0)))
+}
+
+// emptyTree adds a tree with a single empty leaf
+func (b *blocks) emptyTree(blockSize uint32) uint32 {
+	leaf := b.add(pad(encode(uint16(1), uint16(0), uint32(0), uint32(0)), int(blockSize)))
+	return b.tree(blockSize, 0, leaf)
+}
+
+// encode serializes strings and fixed-size values big-endian
+func encode(vals ...interface{}) []byte {
+	buf := &bytes.Buffer{}
+	for _, v := range vals {
+		if s, ok := v.(string); ok {
+			buf.WriteString(s)
+			continue
+		}
+		binary.Write(buf, binary.BigEndian, v)
+	}
+	return buf.Bytes()
+}
+
+// pad extends data with zeros to size
+func pad(data []byte, size int) []byte {
+	if len(data) < size {
+		data = append(data, make([]byte, size-len(data))...)
+	}
+	return data
+}
+
+// Write writes a BOMStore bill of materials for entries to w, in the format
+// pkgbuild generates and lsbom reads. Entries must include every parent
+// directory, starting with the root "."
+func Write(w io.Writer, entries []Entry) error {
+	entries = sortEntries(entries)
+	b := &blocks{}
+
+	ids := map[string]uint32{}
+	for i, e := range entries {
+		ids[e.Path] = uint32(i + 1)
+	}
+
+	info := b.add(encode(uint32(1), uint32(len(entries)), uint32(1), [4]uint32{}))
+
+	type pathIndices struct{ info, file uint32 }
+	indices := make([]pathIndices, len(entries))
+	for i, e := range entries {
+		info2 := encode(pathType(e.Mode), uint8(1), uint16(3), unixMode(e.Mode), e.UID, e.GID,
+			uint32(e.ModTime.Unix()), e.Size, uint8(1), e.Checksum, uint32(0))
+		if e.LinkName != "" {
+			info2 = append(info2[:len(info2)-4], encode(uint32(len(e.LinkName)+1), e.LinkName, uint8(0))...)
+		}
+		info1 := b.add(encode(ids[e.Path], b.add(info2)))
+
+		name, parentID := e.Path, uint32(0)
+		if e.Path != "." {
+			name = path.Base(e.Path)
+			parentID = ids[parent(e.Path)]
+		}
+		file := b.add(encode(parentID, name, uint8(0)))
+		indices[i] = pathIndices{info: info1, file: file}
+	}
+
+	// split paths into linked leaves, reserving block numbers first so
+	// leaves can point forward & backward at each other
+	var leaves []uint32
+	for i := 0; i < len(indices) || i == 0; i += leafSize {
+		leaves = append(leaves, b.add(nil))
+	}
+	for n, leaf := range leaves {
+		start, end := n*leafSize, (n+1)*leafSize
+		if end > len(indices) {
+			end = len(indices)
+		}
+		var forward, backward uint32
+		if n > 0 {
+			backward = leaves[n-1]
+		}
+		if n < len(leaves)-1 {
+			forward = leaves[n+1]
+		}
+		data := encode(uint16(1), uint16(end-start), forward, backward)
+		for _, idx := range indices[start:end] {
+			data = append(data, encode(idx.info, idx.file)...)
+		}
+		b.list[leaf] = pad(data, 4096)
+	}
+
+	root := leaves[0]
+	if len(leaves) > 1 {
+		// branch entries point at each leaf, keyed by the leaf's last path
+		data := encode(uint16(0), uint16(len(leaves)), uint32(0), uint32(0))
+		for n, leaf := range leaves {
+			last := (n+1)*leafSize - 1
+			if last >= len(indices) {
+				last = len(indices) - 1
+			}
+			data = append(data, encode(leaf, indices[last].file)...)
+		}
+		root = b.add(pad(data, 4096))
+	}
+	paths := b.tree(4096, uint32(len(entries)), root)
+
+	hlIndex := b.emptyTree(4096)
+	vIndex := b.add(encode(uint32(1), b.emptyTree(128), uint32(0), uint8(0)))
+	size64 := b.emptyTree(128)
+
+	vars := encode(uint32(5))
+	for _, v := range []struct {
+		name  string
+		index uint32
+	}{
+		{"BomInfo", info},
+		{"Paths", paths},
+		{"HLIndex", hlIndex},
+		{"VIndex", vIndex},
+		{"Size64", size64},
+	} {
+		vars = append(vars, encode(v.index, uint8(len(v.name)), v.name)...)
+	}
+
+	// lay out header, block data, vars, then the block index table
+	data := &bytes.Buffer{}
+	pointers := encode(uint32(len(b.list)))
+	for i, block := range b.list {
+		if i == 0 {
+			pointers = append(pointers, encode(uint32(0), uint32(0))...)
+			continue
+		}
+		pointers = append(pointers, encode(uint32(headerSize+data.Len()), uint32(len(block)))...)
+		data.Write(block)
+	}
+	// free list, which is always empty
+	pointers = append(pointers, encode(uint32(2), [4]uint32{})...)
+
+	varsOffset := headerSize + data.Len()
+	indexOffset := varsOffset + len(vars)
+	header := pad(encode("BOMStore", uint32(1), uint32(len(b.list)-1),
+		uint32(indexOffset), uint32(len(pointers)), uint32(varsOffset), uint32(len(vars))), headerSize)
+
+	for _, chunk := range [][]byte{header, data.Bytes(), vars, pointers} {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
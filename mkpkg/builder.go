@@ -0,0 +1,216 @@
+package mkpkg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Builder creates packages of a single format. Builders are registered with
+// RegisterBuilder, and looked up by target operating system & format name
+type Builder interface {
+	// Name of the package format, eg: deb
+	Name() string
+	// Target is the operating system packages install on, eg: linux
+	Target() string
+	// Available returns an error if p can't be packaged on this host, usually
+	// because a tool its configuration requires isn't installed
+	Available(p Package) error
+	// Build creates a package, returning the files it wrote
+	Build(ctx context.Context, p Package) ([]Artifact, error)
+}
+
+var (
+	buildersMu sync.RWMutex
+	builders   []Builder
+)
+
+// RegisterBuilder makes a package format available by target & name. The
+// first builder registered for a target is that target's default format.
+// RegisterBuilder panics if a builder with the same target & name exists
+func RegisterBuilder(b Builder) {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	for _, r := range builders {
+		if r.Target() == b.Target() && r.Name() == b.Name() {
+			panic(fmt.Sprintf("mkpkg: RegisterBuilder called twice for %s %s", b.Target(), b.Name()))
+		}
+	}
+	builders = append(builders, b)
+}
+
+// Builders lists registered builders, ordered by target. Formats for a
+// target are listed in registration order, default first
+func Builders() []Builder {
+	buildersMu.RLock()
+	defer buildersMu.RUnlock()
+	list := make([]Builder, len(builders))
+	copy(list, builders)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Target() < list[j].Target() })
+	return list
+}
+
+// LookupBuilder finds the builder for a target & format. An empty format
+// selects the target's default
+func LookupBuilder(target, format string) (Builder, error) {
+	var formats []string
+	for _, b := range Builders() {
+		if b.Target() != target {
+			continue
+		}
+		if format == "" || b.Name() == format {
+			return b, nil
+		}
+		formats = append(formats, b.Name())
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("unsupported os: %q. must be one of: %s", target, strings.Join(BuilderTargets(), ","))
+	}
+	return nil, fmt.Errorf("unsupported %s package format: %q. must be one of: %s", target, format, strings.Join(formats, ","))
+}
+
+// BuilderTargets lists operating systems with at least one registered builder
+func BuilderTargets() []string {
+	var targets []string
+	for _, b := range Builders() {
+		if len(targets) == 0 || targets[len(targets)-1] != b.Target() {
+			targets = append(targets, b.Target())
+		}
+	}
+	return targets
+}
+
+// builder adapts a Package method that writes a single file, or files for
+// formats that write more than one, to the Builder interface
+type builder struct {
+	name, target string
+	available    func(p Package) error
+	build        func(p Package) (string, error)
+	files        func(p Package) ([]string, error)
+	// arch returns the architecture packages are built for. nil for formats
+	// that aren't architecture specific
+	arch func(p Package) string
+	// binPath returns the path of the binary that's packaged
+	binPath func(p Package) string
+	// required lists fields the format requires that p doesn't set
+	required func(p Package) []string
+}
+
+func (b builder) Name() string   { return b.name }
+func (b builder) Target() string { return b.target }
+
+func (b builder) Available(p Package) error {
+	if b.available == nil {
+		return nil
+	}
+	return b.available(p)
+}
+
+func (b builder) Build(ctx context.Context, p Package) ([]Artifact, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var paths []string
+	if b.files != nil {
+		files, err := b.files(p)
+		if err != nil {
+			return nil, err
+		}
+		paths = files
+	} else {
+		path, err := b.build(p)
+		if err != nil {
+			return nil, err
+		}
+		paths = []string{path}
+	}
+	arch := ""
+	if b.arch != nil {
+		arch = b.arch(p)
+	}
+	artifacts := make([]Artifact, len(paths))
+	for i, path := range paths {
+		a, err := NewArtifact(p, path, b.name, b.target, arch)
+		if err != nil {
+			return nil, err
+		}
+		artifacts[i] = a
+	}
+	return artifacts, nil
+}
+
+// architectures of built in formats
+func darwinArch(p Package) string  { return p.Darwin.arch() }
+func linuxArch(p Package) string   { return p.Linux.arch() }
+func msiArch(p Package) string     { return p.MSI.arch() }
+func nsisArch(p Package) string    { return p.NSIS.arch() }
+func zipArch(p Package) string     { return p.Zip.arch() }
+func freebsdArch(p Package) string { return p.FreeBSD.arch() }
+
+// binaries packaged by built in formats
+func darwinBinPath(p Package) string  { return p.Darwin.BinPath }
+func linuxBinPath(p Package) string   { return p.Linux.BinPath }
+func msiBinPath(p Package) string     { return p.MSI.BinPath }
+func nsisBinPath(p Package) string    { return p.NSIS.BinPath }
+func zipBinPath(p Package) string     { return p.Zip.BinPath }
+func freebsdBinPath(p Package) string { return p.FreeBSD.BinPath }
+
+// lookPath returns an availability check for required commands
+func lookPath(names ...string) func(p Package) error {
+	return func(p Package) error {
+		for _, name := range names {
+			if _, err := exec.LookPath(name); err != nil {
+				return fmt.Errorf("%s is required and was not found in PATH", name)
+			}
+		}
+		return nil
+	}
+}
+
+// msiAvailable checks the tools of the configured MSI backend
+func msiAvailable(p Package) error {
+	backend, err := p.MSI.backend()
+	if err != nil {
+		return err
+	}
+	if backend == "wixl" {
+		return lookPath("wixl")(p)
+	}
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("the wix MSI backend only runs on windows")
+	}
+	return nil
+}
+
+// flatpakAvailable checks for flatpak tools when a bundle is configured.
+// manifests are written without them
+func flatpakAvailable(p Package) error {
+	if !p.Flatpak.Bundle {
+		return nil
+	}
+	return lookPath("flatpak-builder", "flatpak")(p)
+}
+
+func init() {
+	for _, b := range []builder{
+		{name: "pkg", target: "darwin", build: Package.darwinPKG, arch: darwinArch, binPath: darwinBinPath, required: identifierRequired},
+		{name: "pkg", target: "freebsd", build: Package.freebsdPkg, arch: freebsdArch, binPath: freebsdBinPath},
+		{name: "deb", target: "linux", build: Package.linuxDeb, arch: linuxArch, binPath: linuxBinPath},
+		{name: "rpm", target: "linux", build: Package.linuxRPM, arch: linuxArch, binPath: linuxBinPath},
+		{name: "apk", target: "linux", build: Package.linuxAPK, arch: linuxArch, binPath: linuxBinPath},
+		{name: "pacman", target: "linux", build: Package.linuxPacman, arch: linuxArch, binPath: linuxBinPath},
+		{name: "appimage", target: "linux", build: Package.linuxAppImage, arch: linuxArch, binPath: linuxBinPath, required: appImageRequired},
+		{name: "snap", target: "linux", build: Package.linuxSnap, arch: linuxArch, binPath: linuxBinPath},
+		{name: "flatpak", target: "linux", files: Package.linuxFlatpak, arch: linuxArch, binPath: linuxBinPath, required: identifierRequired, available: flatpakAvailable},
+		{name: "tar.gz", target: "linux", build: Package.linuxTarball, arch: linuxArch, binPath: linuxBinPath},
+		{name: "msi", target: "windows", build: Package.windowsMSI, arch: msiArch, binPath: msiBinPath, available: msiAvailable},
+		{name: "nsis", target: "windows", build: Package.windowsNSIS, arch: nsisArch, binPath: nsisBinPath, available: lookPath("makensis")},
+		{name: "zip", target: "windows", build: Package.windowsZip, arch: zipArch, binPath: zipBinPath},
+	} {
+		RegisterBuilder(b)
+	}
+}
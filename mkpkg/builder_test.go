@@ -0,0 +1,96 @@
+package mkpkg
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// emptyPath clears PATH so no external tools are found. call the returned
+// func to restore it
+func emptyPath(t *testing.T) func() {
+	t.Helper()
+	path := os.Getenv("PATH")
+	if err := os.Setenv("PATH", ""); err != nil {
+		t.Fatal(err)
+	}
+	return func() { os.Setenv("PATH", path) }
+}
+
+func TestAvailableUsesPackage(t *testing.T) {
+	defer emptyPath(t)()
+
+	msi, err := LookupBuilder("windows", "msi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Package{MSI: MSIConfig{Backend: "wixl"}}
+	if err := msi.Available(p); err == nil || !strings.Contains(err.Error(), "wixl") {
+		t.Errorf("expected wixl backend to require wixl, got: %v", err)
+	}
+	p.MSI.Backend = "wix"
+	if err := msi.Available(p); (err == nil) != (runtime.GOOS == "windows") {
+		t.Errorf("wix backend availability mismatch on %s: %v", runtime.GOOS, err)
+	}
+	p.MSI.Backend = "candle"
+	if err := msi.Available(p); err == nil {
+		t.Error("expected an unknown backend to be unavailable")
+	}
+
+	flatpak, err := LookupBuilder("linux", "flatpak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flatpak.Available(Package{}); err != nil {
+		t.Errorf("flatpak manifests shouldn't require tools: %s", err)
+	}
+	if err := flatpak.Available(Package{Flatpak: FlatpakConfig{Bundle: true}}); err == nil || !strings.Contains(err.Error(), "flatpak-builder") {
+		t.Errorf("expected flatpak bundles to require flatpak-builder, got: %v", err)
+	}
+}
+
+func TestLookupBuilder(t *testing.T) {
+	cases := []struct {
+		target, format, want, err string
+	}{
+		{"linux", "", "deb", ""},
+		{"linux", "rpm", "rpm", ""},
+		{"darwin", "", "pkg", ""},
+		{"windows", "", "msi", ""},
+		{"linux", "msi", "", `unsupported linux package format: "msi"`},
+		{"plan9", "", "", `unsupported os: "plan9"`},
+	}
+	for _, c := range cases {
+		b, err := LookupBuilder(c.target, c.format)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s/%s: expected error %q, got: %v", c.target, c.format, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%s: %s", c.target, c.format, err)
+			continue
+		}
+		if b.Target() != c.target || b.Name() != c.want {
+			t.Errorf("%s/%s: got %s %s", c.target, c.format, b.Target(), b.Name())
+		}
+	}
+}
+
+// TestBuilderBinPaths checks every built in format reports the binary it
+// packages, so validation checks it exists
+func TestBuilderBinPaths(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	for _, b := range Builders() {
+		if _, ok := b.(builder); !ok {
+			continue
+		}
+		job := Job{Target: Target{OS: b.Target()}, Package: p, Builder: b}
+		if job.BinPath() == "" {
+			t.Errorf("%s/%s doesn't report a binary path", b.Target(), b.Name())
+		}
+	}
+}
@@ -21,93 +21,131 @@ type DarwinConfig struct {
 	// Path to compatible darwin binary executable to install
 	// name of binary must
 	BinPath string
+	// target architecture using go's GOARCH naming, eg: amd64, arm64.
+	// Default is the architecture mkpkg is running on
+	Arch string
 }
 
-func (p Package) darwinPKG() error {
-	if runtime.GOOS != "darwin" {
-		return fmt.Errorf("can only build darwin installer pkg on darwin (Mac) Operating system")
+// arch returns the configured GOARCH-style architecture, defaulting to the
+// architecture of the running process
+func (c DarwinConfig) arch() string {
+	if c.Arch == "" {
+		return runtime.GOARCH
 	}
+	return c.Arch
+}
 
-	cwd, version, err := p.environ()
+func (p Package) darwinPKG() (string, error) {
+	outDir, version, err := p.environ()
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	// apple's tools are only available on darwin. everywhere else the
+	// package is assembled without them
+	flat := runtime.GOOS != "darwin"
+
+	// product archives built by productbuild resolve package references
+	// against --package-path, flat archives reference packages within
+	// themselves with a "#" prefix
+	pkgRef := fmt.Sprintf("%s.pkg", p.Identifier)
+	if flat {
+		pkgRef = "#" + pkgRef
 	}
 
-	darwinData, err := p.darwinData()
+	darwinData, err := p.darwinData(pkgRef)
 	if err != nil {
-		return err
+		return "", err
 	}
+	tmp, err := workDir("darwin")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
 	// Write out darwin data that is used by the packaging process.
-	defer os.RemoveAll("darwin")
-	if err := writeDataFiles(darwinData, "darwin"); err != nil {
-		return err
+	data := filepath.Join(tmp, "darwin")
+	if err := writeDataFiles(darwinData, data); err != nil {
+		return "", err
 	}
 
 	// Create a work directory and place inside the files as they should
 	// be on the destination file system.
-	work := filepath.Join(cwd, "darwinpkg")
+	work := filepath.Join(tmp, "darwinpkg")
 	if err := os.MkdirAll(work, 0755); err != nil {
-		return err
+		return "", err
 	}
-	defer os.RemoveAll(work)
 
 	// Write out /etc/paths.d/[p.BinName]
 	pathsBody := fmt.Sprintf("/usr/local/%s/bin", p.BinName)
 	pathsDir := filepath.Join(work, "etc/paths.d")
 	pathsFile := filepath.Join(pathsDir, p.BinName)
 	if err := os.MkdirAll(pathsDir, 0755); err != nil {
-		return err
+		return "", err
 	}
 	if err = ioutil.WriteFile(pathsFile, []byte(pathsBody), 0644); err != nil {
-		return err
+		return "", err
 	}
 
 	// Copy installation to /usr/local/[p.BinName]
 	binDir := filepath.Join(work, "usr/local", p.BinName, "bin")
 	if err := os.MkdirAll(binDir, 0755); err != nil {
-		return err
+		return "", err
 	}
 	if err := cp(filepath.Join(binDir, p.BinName), p.Darwin.BinPath); err != nil {
-		return err
+		return "", err
+	}
+
+	if flat {
+		out := filepath.Join(outDir, p.darwinPkgName())
+		if err := p.darwinFlatPKG(work, darwinData, out); err != nil {
+			return "", err
+		}
+		return out, nil
 	}
 
 	// Build the package file.
-	dest := "package"
+	dest := filepath.Join(tmp, "package")
 	if err := os.Mkdir(dest, 0755); err != nil {
-		return err
+		return "", err
 	}
-	defer os.RemoveAll(dest)
 
 	// run pkbuild tool
 	if err := run("pkgbuild",
 		"--identifier", p.Identifier,
 		"--version", version,
-		"--scripts", "darwin/scripts",
+		"--scripts", filepath.Join(data, "scripts"),
 		"--root", work,
 		filepath.Join(dest, fmt.Sprintf("%s.pkg", p.Identifier)),
 	); err != nil {
-		return err
+		return "", err
 	}
 
-	const pkg = "pkg" // known to cmd/release
-	if err := os.Mkdir(pkg, 0755); err != nil {
-		return err
+	out := filepath.Join(outDir, p.darwinPkgName())
+	if err := run("productbuild",
+		"--distribution", filepath.Join(data, "Distribution"),
+		"--resources", filepath.Join(data, "Resources"),
+		"--package-path", dest,
+		out,
+	); err != nil {
+		return "", err
 	}
+	return out, nil
+}
 
-	return run("productbuild",
-		"--distribution", "darwin/Distribution",
-		"--resources", "darwin/Resources",
-		"--package-path", dest,
-		filepath.Join(cwd, pkg, fmt.Sprintf("%s.pkg", p.Name)), // file name irrelevant
-	)
+// darwinPkgName returns the file name of the product archive, eg:
+// Qri CLI-amd64.pkg
+func (p Package) darwinPkgName() string {
+	return fmt.Sprintf("%s-%s.pkg", p.Name, p.Darwin.arch())
 }
 
-func (p Package) darwinData() (map[string]string, error) {
+func (p Package) darwinData(pkgRef string) (map[string]string, error) {
 	// moar info on this: https://developer.apple.com/library/archive/documentation/DeveloperTools/Reference/DistributionDefinitionRef/Chapters/Introduction.html#//apple_ref/doc/uid/TP40005370-CH1-SW1
 	// (docs are apparently out of date, but seem to work ok...)
+	// values are escaped for XML, and as javascript within the script element
 	distTmpl := `<?xml version="1.0" encoding="utf-8" standalone="no"?>
 <installer-script minSpecVersion="1.000000">
-    <title>{{ .Name }}</title>
+    <title>{{ .Name | html }}</title>
     {{ if .Darwin.BgPngPath }}
     <background mime-type="image/png" file="bg.png"/>
     {{ end }}
@@ -119,14 +157,14 @@ func (p Package) darwinData() (map[string]string, error) {
     {{ end}}
     {{ if .Darwin.MinOSXVersion }}
     <allowed-os-versions>
-      <os-version min="{{ .Darwin.MinOSXVersion }}" />
+      <os-version min="{{ .Darwin.MinOSXVersion | html }}" />
     </allowed-os-versions>
     {{ end }}
     <script>
 function installCheck() {
-    if(system.files.fileExistsAtPath('/usr/local/{{ .BinName }}/bin/{{ .BinName }}')) {
+    if(system.files.fileExistsAtPath('/usr/local/{{ .BinName | js }}/bin/{{ .BinName | js }}')) {
       my.result.title = 'Previous Installation Detected';
-      my.result.message = 'A previous installation of {{ .Name }} exists at /usr/local/{{ .BinName }}. This installer will remove the previous installation prior to installing. Please back up any data before proceeding.';
+      my.result.message = 'A previous installation of {{ .Name | js }} exists at /usr/local/{{ .BinName | js }}. This installer will remove the previous installation prior to installing. Please back up any data before proceeding.';
       my.result.type = 'Warning';
       return false;
   }
@@ -134,18 +172,21 @@ function installCheck() {
 }
     </script>
     <choices-outline>
-        <line choice="{{ .Identifier }}.choice"/>
+        <line choice="{{ .Identifier | html }}.choice"/>
     </choices-outline>
-    <choice id="{{ .Identifier }}.choice" title="{{ .Name }}">
-        <pkg-ref id="{{ .Identifier }}.pkg"/>
+    <choice id="{{ .Identifier | html }}.choice" title="{{ .Name | html }}">
+        <pkg-ref id="{{ .Identifier | html }}.pkg"/>
     </choice>
-    <pkg-ref id="{{ .Identifier }}.pkg" auth="Root">{{ .Identifier }}.pkg</pkg-ref>
+    <pkg-ref id="{{ .Identifier | html }}.pkg" auth="Root">{{ .PkgRef | html }}</pkg-ref>
     {{ if .Darwin.ConclusionMsg }}
     <conclusion mime-type="text/plain" file="conclusion.txt"/>
     {{ end }}
 </installer-script>
 `
-	dist, err := p.execTemplate(distTmpl)
+	dist, err := renderTemplate(distTmpl, struct {
+		Package
+		PkgRef string
+	}{p, pkgRef})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,185 @@
+package mkpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/qri-io/mkpkg/mkpkg/bom"
+	"github.com/qri-io/mkpkg/mkpkg/xar"
+)
+
+// darwinFlatPKG assembles a flat product archive from the staged work
+// directory without apple's pkgbuild & productbuild tools. A product archive
+// is a xar archive holding a Distribution, installer Resources, and a
+// component package directory containing a Bom, PackageInfo, Payload and
+// Scripts.
+func (p Package) darwinFlatPKG(work string, darwinData map[string]string, dest string) error {
+	var (
+		payload = &bytes.Buffer{}
+		ino     uint32
+		kbytes  int64
+	)
+	now := time.Now()
+
+	// Archive the work tree as it should be on the destination file system.
+	err := filepath.Walk(work, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(work, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." {
+			rel = "./" + rel
+		}
+
+		mode := uint32(0100000 | info.Mode().Perm())
+		var body []byte
+		if info.IsDir() {
+			mode = 040000 | uint32(info.Mode().Perm())
+		} else {
+			if body, err = ioutil.ReadFile(path); err != nil {
+				return err
+			}
+			kbytes += (int64(len(body)) + 1023) / 1024
+		}
+
+		ino++
+		return writeCpioOdcEntry(payload, ino, rel, mode, info.ModTime(), body)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeCpioOdcEntry(payload, 0, "TRAILER!!!", 0, time.Unix(0, 0), nil); err != nil {
+		return err
+	}
+
+	// Archive install scripts.
+	scripts := &bytes.Buffer{}
+	if err := writeCpioOdcEntry(scripts, 1, ".", 040755, now, nil); err != nil {
+		return err
+	}
+	for i, name := range []string{"preinstall", "postinstall"} {
+		if err := writeCpioOdcEntry(scripts, uint32(i+2), "./"+name, 0100755, now, []byte(darwinData["scripts/"+name])); err != nil {
+			return err
+		}
+	}
+	if err := writeCpioOdcEntry(scripts, 0, "TRAILER!!!", 0, time.Unix(0, 0), nil); err != nil {
+		return err
+	}
+
+	// Record the bill of materials for the same tree.
+	entries, err := bom.FromDir(work)
+	if err != nil {
+		return err
+	}
+	bomBuf := &bytes.Buffer{}
+	if err := bom.Write(bomBuf, entries); err != nil {
+		return err
+	}
+
+	payloadGz, err := gzipBytes(payload.Bytes())
+	if err != nil {
+		return err
+	}
+	scriptsGz, err := gzipBytes(scripts.Bytes())
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	xw, err := xar.NewWriter(f, xar.WriterOptions{})
+	if err != nil {
+		return err
+	}
+	component := p.Identifier + ".pkg"
+	type entry struct {
+		name     string
+		body     []byte
+		encoding xar.Encoding
+	}
+	files := []entry{
+		{"Distribution", []byte(darwinData["Distribution"]), xar.EncodingGzip},
+		{component + "/Bom", bomBuf.Bytes(), xar.EncodingGzip},
+		{component + "/PackageInfo", []byte(p.darwinPackageInfo(len(entries), kbytes)), xar.EncodingGzip},
+		// payload & scripts are already compressed
+		{component + "/Payload", payloadGz, xar.EncodingNone},
+		{component + "/Scripts", scriptsGz, xar.EncodingNone},
+	}
+	for _, name := range []string{"Resources/bg.png", "Resources/conclusion.txt", "Resources/welcome.txt"} {
+		if body := darwinData[name]; body != "" {
+			files = append(files, entry{name, []byte(body), xar.EncodingGzip})
+		}
+	}
+	for _, file := range files {
+		hdr := xar.FileHeader{Name: file.name, Mode: 0644, ModTime: now, Encoding: file.encoding}
+		if err := xw.WriteFile(hdr, file.body); err != nil {
+			return err
+		}
+	}
+	if err := xw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// darwinPackageInfo generates the PackageInfo file of a component package
+func (p Package) darwinPackageInfo(numberOfFiles int, installKBytes int64) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<pkg-info overwrite-permissions="true" relocatable="false" identifier="%s" postinstall-action="none" version="%s" format-version="2" install-location="/" auth="root">
+    <payload numberOfFiles="%d" installKBytes="%d"/>
+    <bundle-version/>
+    <upgrade-bundle/>
+    <update-bundle/>
+    <atomic-update-bundle/>
+    <strict-identifier/>
+    <relocate/>
+    <scripts>
+        <preinstall file="./preinstall"/>
+        <postinstall file="./postinstall"/>
+    </scripts>
+</pkg-info>
+`, xmlEscape(p.Identifier), xmlEscape(p.Version), numberOfFiles, installKBytes)
+}
+
+// writeCpioOdcEntry writes a single "odc" (portable ASCII) format cpio entry
+// to w, the format macOS installer payloads use
+func writeCpioOdcEntry(w io.Writer, ino uint32, name string, mode uint32, modTime time.Time, body []byte) error {
+	nlink := 1
+	if mode&040000 != 0 {
+		nlink = 2
+	}
+	hdr := fmt.Sprintf("070707%06o%06o%06o%06o%06o%06o%06o%011o%06o%011o",
+		0, ino&0777777, mode, 0, 0, nlink, 0, modTime.Unix(), len(name)+1, len(body))
+	if _, err := io.WriteString(w, hdr+name+"\x00"); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// gzipBytes compresses data with gzip
+func gzipBytes(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
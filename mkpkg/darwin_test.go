@@ -0,0 +1,131 @@
+package mkpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/mkpkg/mkpkg/bom"
+	"github.com/qri-io/mkpkg/mkpkg/xar"
+)
+
+// readCpioOdc lists the names & bodies of entries in an odc cpio archive
+func readCpioOdc(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	for {
+		if len(data) < 76 || string(data[:6]) != "070707" {
+			t.Fatalf("bad odc cpio header")
+		}
+		field := func(start, end int) int {
+			v, err := strconv.ParseUint(string(data[start:end]), 8, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return int(v)
+		}
+		nameSize, size := field(59, 65), field(65, 76)
+		name := string(data[76 : 76+nameSize-1])
+		if name == "TRAILER!!!" {
+			return files
+		}
+		files[name] = data[76+nameSize : 76+nameSize+size]
+		data = data[76+nameSize+size:]
+	}
+}
+
+func TestDarwinFlatPKG(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("darwin builds packages with pkgbuild & productbuild")
+	}
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Name = `Qri & "Friends" <it's>`
+
+	path, err := p.darwinPKG()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := xar.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	dist, err := r.ReadFile("Distribution")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := struct {
+		Title  string `xml:"title"`
+		Script string `xml:"script"`
+		Choice struct {
+			Title string `xml:"title,attr"`
+		} `xml:"choice"`
+		PkgRefs []string `xml:"pkg-ref"`
+	}{}
+	if err := xml.Unmarshal(dist, &doc); err != nil {
+		t.Fatalf("Distribution isn't valid XML: %s\n%s", err, dist)
+	}
+	if doc.Title != p.Name || doc.Choice.Title != p.Name {
+		t.Errorf("name mismatch. title: %q, choice: %q", doc.Title, doc.Choice.Title)
+	}
+	if !strings.Contains(doc.Script, `of Qri \u0026 \"Friends\" \u003Cit\'s\u003E exists`) {
+		t.Errorf("name isn't escaped in the install check script:\n%s", doc.Script)
+	}
+	if strings.Join(doc.PkgRefs, ",") != "#io.qri.cli.pkg" {
+		t.Errorf("pkg-ref mismatch: %q", doc.PkgRefs)
+	}
+
+	info, err := r.ReadFile("io.qri.cli.pkg/PackageInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(info, &struct{}{}); err != nil {
+		t.Errorf("PackageInfo isn't valid XML: %s", err)
+	}
+
+	bomData, err := r.ReadFile("io.qri.cli.pkg/Bom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := bom.Read(bomData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	if got, want := strings.Join(paths, ","), ".,./etc,./usr,./etc/paths.d,./usr/local,./etc/paths.d/qri,./usr/local/qri,./usr/local/qri/bin,./usr/local/qri/bin/qri"; got != want {
+		t.Errorf("bom paths mismatch.\ngot:  %s\nwant: %s", got, want)
+	}
+
+	payloadGz, err := r.ReadFile("io.qri.cli.pkg/Payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(payloadGz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readCpioOdc(t, payload)
+	if string(files["./usr/local/qri/bin/qri"]) != testBin {
+		t.Errorf("payload binary mismatch: %q", files["./usr/local/qri/bin/qri"])
+	}
+	if string(files["./etc/paths.d/qri"]) != "/usr/local/qri/bin" {
+		t.Errorf("paths.d entry mismatch: %q", files["./etc/paths.d/qri"])
+	}
+	if len(files) != len(entries) {
+		t.Errorf("payload has %d entries, bom has %d", len(files), len(entries))
+	}
+}
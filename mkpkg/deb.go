@@ -0,0 +1,138 @@
+package mkpkg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// debArchs maps GOARCH values to debian architecture names
+var debArchs = map[string]string{
+	"386":      "i386",
+	"amd64":    "amd64",
+	"arm":      "armhf",
+	"arm64":    "arm64",
+	"ppc64le":  "ppc64el",
+	"s390x":    "s390x",
+	"mips64le": "mips64el",
+}
+
+func (p Package) linuxDeb() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := debArchs[p.Linux.arch()]
+	if !ok {
+		return "", fmt.Errorf("unsupported debian architecture: %s", p.Linux.arch())
+	}
+
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Place files inside the data archive as they should be on the
+	// destination file system.
+	binPath := strings.TrimPrefix(filepath.ToSlash(filepath.Join(p.Linux.prefix(), "bin", p.BinName)), "/")
+	data := withParentDirs([]archiveFile{
+		{Name: binPath, Mode: 0755, Body: bin},
+	})
+	for i := range data {
+		data[i].Name = "./" + data[i].Name
+	}
+	dataTar := &bytes.Buffer{}
+	if err := writeTarGz(dataTar, append([]archiveFile{{Name: "./", Mode: 0755, Dir: true}}, data...)); err != nil {
+		return "", err
+	}
+
+	control := p.debControl(arch, len(bin))
+	md5sums := fmt.Sprintf("%x  %s\n", md5.Sum(bin), binPath)
+	controlTar := &bytes.Buffer{}
+	if err := writeTarGz(controlTar, []archiveFile{
+		{Name: "./", Mode: 0755, Dir: true},
+		{Name: "./control", Mode: 0644, Body: []byte(control)},
+		{Name: "./md5sums", Mode: 0644, Body: []byte(md5sums)},
+	}); err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(filepath.Join(outDir, fmt.Sprintf("%s_%s_%s.deb", p.BinName, p.pkgVersion(), arch)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// debian packages are an ar archive. debian-binary must come first
+	if err := writeAr(f, []archiveFile{
+		{Name: "debian-binary", Mode: 0644, Body: []byte("2.0\n")},
+		{Name: "control.tar.gz", Mode: 0644, Body: controlTar.Bytes()},
+		{Name: "data.tar.gz", Mode: 0644, Body: dataTar.Bytes()},
+	}); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// debControl generates the contents of a debian control file
+func (p Package) debControl(arch string, binSize int) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Package: %s\n", p.BinName)
+	fmt.Fprintf(buf, "Version: %s\n", p.pkgVersion())
+	fmt.Fprintf(buf, "Architecture: %s\n", arch)
+	fmt.Fprintf(buf, "Maintainer: %s\n", p.maintainer())
+	fmt.Fprintf(buf, "Installed-Size: %d\n", (binSize+1023)/1024)
+	fmt.Fprintf(buf, "Section: utils\n")
+	fmt.Fprintf(buf, "Priority: optional\n")
+	if p.SiteURL != "" {
+		fmt.Fprintf(buf, "Homepage: %s\n", p.SiteURL)
+	}
+	fmt.Fprintf(buf, "Description: %s\n", p.Name)
+	desc := strings.TrimSpace(p.Description)
+	if desc == "" {
+		return buf.String()
+	}
+	// extended description lines must be indented by a single space, with
+	// blank lines represented by a lone "."
+	for _, line := range strings.Split(desc, "\n") {
+		if strings.TrimSpace(line) == "" {
+			line = "."
+		}
+		fmt.Fprintf(buf, " %s\n", line)
+	}
+	return buf.String()
+}
+
+// writeAr writes files to w in the common unix ar archive format
+func writeAr(w io.Writer, files []archiveFile) error {
+	if _, err := io.WriteString(w, "!<arch>\n"); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, f := range files {
+		hdr := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", f.Name, now, 0, 0, 0100000|f.Mode, len(f.Body))
+		if _, err := io.WriteString(w, hdr); err != nil {
+			return err
+		}
+		if _, err := w.Write(f.Body); err != nil {
+			return err
+		}
+		// ar members are aligned to even byte boundaries
+		if len(f.Body)%2 != 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package mkpkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// arMember is a file read back out of an ar archive
+type arMember struct {
+	Name string
+	Body []byte
+}
+
+// readAr parses an ar archive
+func readAr(t *testing.T, data []byte) []arMember {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		t.Fatalf("missing ar magic")
+	}
+	data = data[8:]
+	var members []arMember
+	for len(data) > 0 {
+		if len(data) < 60 {
+			t.Fatalf("truncated ar header")
+		}
+		hdr := data[:60]
+		if string(hdr[58:60]) != "`\n" {
+			t.Fatalf("bad ar header terminator: %q", hdr[58:60])
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(string(hdr[48:58])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = data[60:]
+		if len(data) < size {
+			t.Fatalf("truncated ar member")
+		}
+		members = append(members, arMember{Name: strings.TrimSpace(string(hdr[:16])), Body: data[:size]})
+		data = data[size+size%2:]
+	}
+	return members
+}
+
+func TestLinuxDeb(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path, err := p.linuxDeb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, "qri_0.5.0_amd64.deb") {
+		t.Errorf("unexpected package path: %s", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	members := readAr(t, data)
+	var names []string
+	for _, m := range members {
+		names = append(names, m.Name)
+	}
+	if got, want := strings.Join(names, ","), "debian-binary,control.tar.gz,data.tar.gz"; got != want {
+		t.Fatalf("ar members mismatch. got: %s, want: %s", got, want)
+	}
+	if string(members[0].Body) != "2.0\n" {
+		t.Errorf("debian-binary mismatch: %q", members[0].Body)
+	}
+
+	control := readTarGz(t, members[1].Body)
+	controlFile := string(tarFile(t, control, "./control").Body)
+	for _, line := range []string{"Package: qri\n", "Version: 0.5.0\n", "Architecture: amd64\n", "Description: Qri CLI\n qri is a web of datasets\n .\n second paragraph\n"} {
+		if !strings.Contains(controlFile, line) {
+			t.Errorf("control file missing %q:\n%s", line, controlFile)
+		}
+	}
+	md5sums := string(tarFile(t, control, "./md5sums").Body)
+	if !strings.HasSuffix(md5sums, "  usr/bin/qri\n") {
+		t.Errorf("md5sums mismatch: %q", md5sums)
+	}
+
+	files := readTarGz(t, members[2].Body)
+	if got, want := strings.Join(tarNames(files), ","), "./,./usr/,./usr/bin/,./usr/bin/qri"; got != want {
+		t.Errorf("data entries mismatch. got: %s, want: %s", got, want)
+	}
+	bin := tarFile(t, files, "./usr/bin/qri")
+	if string(bin.Body) != testBin || bin.Header.Mode != 0755 {
+		t.Errorf("binary mismatch. mode: %o body: %q", bin.Header.Mode, bin.Body)
+	}
+
+	if _, err := exec.LookPath("dpkg-deb"); err != nil {
+		t.Log("dpkg-deb not found, skipping dpkg-deb checks")
+		return
+	}
+	out, err := exec.Command("dpkg-deb", "--info", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("dpkg-deb --info: %s\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("Package: qri")) {
+		t.Errorf("dpkg-deb --info output missing package:\n%s", out)
+	}
+}
+
+func TestDebControlEmptyDescription(t *testing.T) {
+	p := Package{Name: "Qri CLI", BinName: "qri", Version: "v1.0.0"}
+	control := p.debControl("amd64", 10)
+	if !strings.HasSuffix(control, "Description: Qri CLI\n") {
+		t.Errorf("expected control file to end with the summary alone:\n%s", control)
+	}
+	if strings.Contains(control, " .\n") {
+		t.Errorf("control file has an empty extended description:\n%s", control)
+	}
+}
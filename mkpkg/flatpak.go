@@ -0,0 +1,279 @@
+package mkpkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FlatpakConfig encapsulates configuration details for creating a flatpak
+// manifest & bundle. Flatpaks install the binary & icon from the Linux
+// configuration, with Identifier as the application id
+type FlatpakConfig struct {
+	// runtime the application runs against. Default is org.freedesktop.Platform
+	Runtime string
+	// version of the runtime & sdk. Default is 23.08
+	RuntimeVersion string
+	// sdk the application is built with. Default is org.freedesktop.Sdk
+	SDK string
+	// sandbox permissions, eg: --share=network. Default is network & home
+	// directory access
+	FinishArgs []string
+	// build a single-file .flatpak bundle with flatpak-builder. When false
+	// only the manifest & the files it references are written
+	Bundle bool
+}
+
+// runtime returns the configured runtime, defaulting to org.freedesktop.Platform
+func (c FlatpakConfig) runtime() string {
+	if c.Runtime == "" {
+		return "org.freedesktop.Platform"
+	}
+	return c.Runtime
+}
+
+// runtimeVersion returns the configured runtime version, defaulting to 23.08
+func (c FlatpakConfig) runtimeVersion() string {
+	if c.RuntimeVersion == "" {
+		return "23.08"
+	}
+	return c.RuntimeVersion
+}
+
+// sdk returns the configured sdk, defaulting to org.freedesktop.Sdk
+func (c FlatpakConfig) sdk() string {
+	if c.SDK == "" {
+		return "org.freedesktop.Sdk"
+	}
+	return c.SDK
+}
+
+// finishArgs returns the configured permissions, defaulting to network &
+// home directory access
+func (c FlatpakConfig) finishArgs() []string {
+	if c.FinishArgs == nil {
+		return []string{"--share=network", "--filesystem=home"}
+	}
+	return c.FinishArgs
+}
+
+// flatpakArchs maps GOARCH values to flatpak architecture names
+var flatpakArchs = map[string]string{
+	"386":   "i386",
+	"amd64": "x86_64",
+	"arm":   "arm",
+	"arm64": "aarch64",
+}
+
+// flatpakManifest is a flatpak-builder manifest
+type flatpakManifest struct {
+	AppID          string          `json:"app-id"`
+	Runtime        string          `json:"runtime"`
+	RuntimeVersion string          `json:"runtime-version"`
+	SDK            string          `json:"sdk"`
+	Command        string          `json:"command"`
+	FinishArgs     []string        `json:"finish-args"`
+	Modules        []flatpakModule `json:"modules"`
+}
+
+type flatpakModule struct {
+	Name          string          `json:"name"`
+	Buildsystem   string          `json:"buildsystem"`
+	BuildCommands []string        `json:"build-commands"`
+	Sources       []flatpakSource `json:"sources"`
+}
+
+type flatpakSource struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// linuxFlatpak writes a flatpak manifest & the files it installs to
+// flatpak-[arch]. It returns the .flatpak bundle if one is configured, the
+// manifest & metainfo otherwise
+func (p Package) linuxFlatpak() ([]string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return nil, err
+	}
+	if p.Identifier == "" {
+		return nil, fmt.Errorf("Identifier is required to create a flatpak")
+	}
+
+	arch, ok := flatpakArchs[p.Linux.arch()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported flatpak architecture: %s", p.Linux.arch())
+	}
+
+	id := p.Identifier
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return nil, err
+	}
+	metainfo, err := p.appStreamMetainfo(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// files are written alongside the manifest, and installed to their
+	// destination within the sandbox's /app
+	type flatpakFile struct {
+		name, dest string
+		mode       os.FileMode
+		body       []byte
+	}
+	files := []flatpakFile{
+		{p.BinName, path.Join("bin", p.BinName), 0755, bin},
+		{id + ".metainfo.xml", path.Join("share/metainfo", id+".metainfo.xml"), 0644, []byte(metainfo)},
+		{id + ".desktop", path.Join("share/applications", id+".desktop"), 0644, []byte(p.desktopEntry(p.BinName, id))},
+	}
+	if p.Linux.IconPath != "" {
+		icon, err := ioutil.ReadFile(p.Linux.IconPath)
+		if err != nil {
+			return nil, err
+		}
+		ext := strings.ToLower(filepath.Ext(p.Linux.IconPath))
+		size := "scalable"
+		if ext == ".png" {
+			cfg, err := png.DecodeConfig(bytes.NewReader(icon))
+			if err != nil {
+				return nil, err
+			}
+			size = fmt.Sprintf("%dx%d", cfg.Width, cfg.Height)
+		}
+		files = append(files, flatpakFile{id + ext, path.Join("share/icons/hicolor", size, "apps", id+ext), 0644, icon})
+	}
+
+	module := flatpakModule{Name: p.BinName, Buildsystem: "simple"}
+	for _, f := range files {
+		module.BuildCommands = append(module.BuildCommands, fmt.Sprintf("install -Dm%o %s /app/%s", f.mode, f.name, f.dest))
+		module.Sources = append(module.Sources, flatpakSource{Type: "file", Path: f.name})
+	}
+
+	manifest, err := json.MarshalIndent(flatpakManifest{
+		AppID:          id,
+		Runtime:        p.Flatpak.runtime(),
+		RuntimeVersion: p.Flatpak.runtimeVersion(),
+		SDK:            p.Flatpak.sdk(),
+		Command:        p.BinName,
+		FinishArgs:     p.Flatpak.finishArgs(),
+		Modules:        []flatpakModule{module},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, flatpakFile{name: id + ".json", mode: 0644, body: append(manifest, '\n')})
+
+	// only the binary is executable. manifests are written per-architecture,
+	// so flatpaks for different architectures can be built at once
+	dir := filepath.Join(outDir, "flatpak-"+p.Linux.arch())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.name), f.body, f.mode); err != nil {
+			return nil, err
+		}
+	}
+	if !p.Flatpak.Bundle {
+		// without a bundle the build manifest & metainfo are the artifacts
+		return []string{filepath.Join(dir, id+".json"), filepath.Join(dir, id+".metainfo.xml")}, nil
+	}
+
+	tmp, err := workDir("flatpak")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	build := filepath.Join(tmp, "build")
+	repo := filepath.Join(tmp, "repo")
+	state := filepath.Join(tmp, "state")
+	// flatpak-builder builds for the host architecture unless told otherwise.
+	// building for another architecture needs the runtime & sdk for it, and
+	// qemu to run build commands
+	if err := runDir(dir, "flatpak-builder", "--arch="+arch, "--force-clean", "--state-dir", state, "--repo", repo, build, id+".json"); err != nil {
+		return nil, err
+	}
+	bundle := filepath.Join(outDir, fmt.Sprintf("%s-%s-linux-%s.flatpak", p.BinName, p.Version, p.Linux.arch()))
+	if err := run("flatpak", "build-bundle", "--arch="+arch, repo, bundle, id); err != nil {
+		return nil, err
+	}
+	return []string{bundle}, nil
+}
+
+// appStream is an AppStream metainfo component
+type appStream struct {
+	XMLName         xml.Name           `xml:"component"`
+	Type            string             `xml:"type,attr"`
+	ID              string             `xml:"id"`
+	MetadataLicense string             `xml:"metadata_license"`
+	ProjectLicense  string             `xml:"project_license,omitempty"`
+	Name            string             `xml:"name"`
+	Summary         string             `xml:"summary"`
+	Description     []string           `xml:"description>p"`
+	URL             *appStreamURL      `xml:"url,omitempty"`
+	Launchable      appStreamLaunch    `xml:"launchable"`
+	Binary          string             `xml:"provides>binary"`
+	Releases        []appStreamRelease `xml:"releases>release"`
+}
+
+type appStreamURL struct {
+	Type string `xml:"type,attr"`
+	URL  string `xml:",chardata"`
+}
+
+type appStreamLaunch struct {
+	Type string `xml:"type,attr"`
+	ID   string `xml:",chardata"`
+}
+
+type appStreamRelease struct {
+	Version string `xml:"version,attr"`
+	Date    string `xml:"date,attr"`
+}
+
+// appStreamMetainfo generates AppStream metainfo describing the package,
+// listing the current version as released on date
+func (p Package) appStreamMetainfo(date time.Time) (string, error) {
+	component := appStream{
+		Type:            "console-application",
+		ID:              p.Identifier,
+		MetadataLicense: "CC0-1.0",
+		ProjectLicense:  p.License,
+		Name:            p.Name,
+		Summary:         p.summary(),
+		Launchable:      appStreamLaunch{Type: "desktop-id", ID: p.Identifier + ".desktop"},
+		Binary:          p.BinName,
+		Releases:        []appStreamRelease{{Version: p.pkgVersion(), Date: date.Format("2006-01-02")}},
+	}
+	if p.Linux.GUI {
+		component.Type = "desktop-application"
+	}
+	if p.SiteURL != "" {
+		component.URL = &appStreamURL{Type: "homepage", URL: p.SiteURL}
+	}
+	// paragraphs are separated by blank lines
+	for _, para := range strings.Split(strings.TrimSpace(p.Description), "\n\n") {
+		if para = strings.Join(strings.Fields(para), " "); para != "" {
+			component.Description = append(component.Description, para)
+		}
+	}
+	if len(component.Description) == 0 {
+		component.Description = []string{p.summary()}
+	}
+
+	b, err := xml.MarshalIndent(component, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(b) + "\n", nil
+}
@@ -0,0 +1,109 @@
+package mkpkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLinuxFlatpak(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	icon := &bytes.Buffer{}
+	if err := png.Encode(icon, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	p.Linux.IconPath = filepath.Join(filepath.Dir(p.LicensePath), "icon.png")
+	if err := ioutil.WriteFile(p.Linux.IconPath, icon.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := p.linuxFlatpak()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(p.OutDir, "flatpak-amd64")
+	modes := map[string]os.FileMode{
+		"qri":                     0755,
+		"io.qri.cli.json":         0644,
+		"io.qri.cli.metainfo.xml": 0644,
+		"io.qri.cli.desktop":      0644,
+		"io.qri.cli.png":          0644,
+	}
+	for name, mode := range modes {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if fi.Mode().Perm() != mode {
+			t.Errorf("%s: mode %o, want %o", name, fi.Mode().Perm(), mode)
+		}
+	}
+	want := []string{filepath.Join(dir, "io.qri.cli.json"), filepath.Join(dir, "io.qri.cli.metainfo.xml")}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("output paths mismatch.\ngot:  %v\nwant: %v", paths, want)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "io.qri.cli.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := flatpakManifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.AppID != "io.qri.cli" || manifest.Command != "qri" || manifest.Runtime != "org.freedesktop.Platform" {
+		t.Errorf("manifest mismatch: %#v", manifest)
+	}
+	commands := strings.Join(manifest.Modules[0].BuildCommands, "\n")
+	for _, cmd := range []string{
+		"install -Dm755 qri /app/bin/qri",
+		"install -Dm644 io.qri.cli.metainfo.xml /app/share/metainfo/io.qri.cli.metainfo.xml",
+		"install -Dm644 io.qri.cli.png /app/share/icons/hicolor/64x64/apps/io.qri.cli.png",
+	} {
+		if !strings.Contains(commands, cmd) {
+			t.Errorf("build commands missing %q:\n%s", cmd, commands)
+		}
+	}
+	if len(manifest.Modules[0].Sources) != len(modes)-1 {
+		t.Errorf("expected a source for every installed file, got %d", len(manifest.Modules[0].Sources))
+	}
+
+	p.Linux.Arch = "s390x"
+	if _, err := p.linuxFlatpak(); err == nil {
+		t.Errorf("expected unsupported architecture error")
+	}
+}
+
+func TestAppStreamMetainfo(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	date := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	metainfo, err := p.appStreamMetainfo(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	component := appStream{}
+	if err := xml.Unmarshal([]byte(metainfo), &component); err != nil {
+		t.Fatal(err)
+	}
+	if component.ID != "io.qri.cli" || component.Type != "console-application" || component.ProjectLicense != "GPL-3.0" {
+		t.Errorf("component mismatch: %#v", component)
+	}
+	if strings.Join(component.Description, "|") != "qri is a web of datasets|second paragraph" {
+		t.Errorf("description paragraphs mismatch: %q", component.Description)
+	}
+	if len(component.Releases) != 1 || component.Releases[0].Version != "0.5.0" || component.Releases[0].Date != "2019-06-01" {
+		t.Errorf("releases mismatch: %#v", component.Releases)
+	}
+}
@@ -0,0 +1,161 @@
+package mkpkg
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// FreeBSDConfig encapsulates configuration details for creating a FreeBSD
+// pkg. Maintainer details are shared with the Linux configuration
+type FreeBSDConfig struct {
+	// Path to compatible freebsd binary executable to install
+	BinPath string
+	// target architecture using go's GOARCH naming, eg: amd64, 386, arm64.
+	// Default is the architecture mkpkg is running on
+	Arch string
+	// major version of FreeBSD the binary targets. Default is 13
+	OSVersion string
+	// ports tree origin of the package. Default is sysutils/[BinName]
+	Origin string
+}
+
+// freebsdArchs maps GOARCH values to FreeBSD ABI architecture names
+var freebsdArchs = map[string]string{
+	"386":   "i386",
+	"amd64": "amd64",
+	"arm":   "armv7",
+	"arm64": "aarch64",
+}
+
+// arch returns the configured GOARCH-style architecture, defaulting to the
+// architecture of the running process
+func (c FreeBSDConfig) arch() string {
+	if c.Arch == "" {
+		return runtime.GOARCH
+	}
+	return c.Arch
+}
+
+// osVersion returns the configured FreeBSD major version, defaulting to 13
+func (c FreeBSDConfig) osVersion() string {
+	if c.OSVersion == "" {
+		return "13"
+	}
+	return c.OSVersion
+}
+
+// freebsdManifest is a pkg manifest. the compact manifest omits files
+type freebsdManifest struct {
+	Name         string            `json:"name"`
+	Origin       string            `json:"origin"`
+	Version      string            `json:"version"`
+	Comment      string            `json:"comment"`
+	Maintainer   string            `json:"maintainer"`
+	WWW          string            `json:"www,omitempty"`
+	ABI          string            `json:"abi"`
+	Prefix       string            `json:"prefix"`
+	Flatsize     int               `json:"flatsize"`
+	Licenselogic string            `json:"licenselogic"`
+	Licenses     []string          `json:"licenses"`
+	Desc         string            `json:"desc"`
+	Categories   []string          `json:"categories"`
+	Files        map[string]string `json:"files,omitempty"`
+}
+
+// freebsdPkg writes a pkg(8) package: a zstd compressed tar archive that
+// begins with the package manifests, followed by files at their absolute
+// install paths
+func (p Package) freebsdPkg() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := freebsdArchs[p.FreeBSD.arch()]
+	if !ok {
+		return "", fmt.Errorf("unsupported freebsd architecture: %s", p.FreeBSD.arch())
+	}
+
+	bin, err := ioutil.ReadFile(p.FreeBSD.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	const prefix = "/usr/local"
+	binPath := path.Join(prefix, "bin", p.BinName)
+
+	origin := p.FreeBSD.Origin
+	if origin == "" {
+		origin = path.Join("sysutils", p.BinName)
+	}
+	desc := strings.TrimSpace(p.Description)
+	if desc == "" {
+		desc = p.Name
+	}
+
+	manifest := freebsdManifest{
+		Name:         p.BinName,
+		Origin:       origin,
+		Version:      strings.Replace(p.pkgVersion(), "-", ".", -1),
+		Comment:      p.summary(),
+		Maintainer:   p.maintainer(),
+		WWW:          p.SiteURL,
+		ABI:          fmt.Sprintf("FreeBSD:%s:%s", p.FreeBSD.osVersion(), arch),
+		Prefix:       prefix,
+		Flatsize:     len(bin),
+		Licenselogic: "single",
+		Licenses:     []string{p.license()},
+		Desc:         desc,
+		Categories:   []string{path.Dir(origin)},
+	}
+	compact, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	// file checksums are prefixed with their hash type. 1 is hex sha256
+	manifest.Files = map[string]string{
+		binPath: fmt.Sprintf("1$%x", sha256.Sum256(bin)),
+	}
+	full, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(filepath.Join(outDir, fmt.Sprintf("%s-%s-%s.pkg", manifest.Name, manifest.Version, arch)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return "", err
+	}
+	// pkg reads the manifests from the start of the archive, so they come
+	// before the payload. the payload's parent directories belong to the
+	// base system, and are left out
+	files := []archiveFile{
+		{Name: "+COMPACT_MANIFEST", Mode: 0644, Body: compact},
+		{Name: "+MANIFEST", Mode: 0644, Body: full},
+		{Name: binPath, Mode: 0755, Body: bin},
+	}
+	if err := writeTar(zw, files); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
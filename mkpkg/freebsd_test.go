@@ -0,0 +1,83 @@
+package mkpkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFreeBSDPkg(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path, err := p.freebsdPkg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(path); got != "qri-0.5.0-amd64.pkg" {
+		t.Errorf("package name mismatch: %s", got)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	entries := readTar(t, zr)
+	// the package doesn't claim base system directories
+	want := "+COMPACT_MANIFEST,+MANIFEST,/usr/local/bin/qri"
+	if got := strings.Join(tarNames(entries), ","); got != want {
+		t.Errorf("entries mismatch.\ngot:  %s\nwant: %s", got, want)
+	}
+	bin := tarFile(t, entries, "/usr/local/bin/qri")
+	if string(bin.Body) != testBin || bin.Header.Mode != 0755 {
+		t.Errorf("binary mismatch. mode: %o body: %q", bin.Header.Mode, bin.Body)
+	}
+
+	var compact, full freebsdManifest
+	if err := json.Unmarshal(tarFile(t, entries, "+COMPACT_MANIFEST").Body, &compact); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(tarFile(t, entries, "+MANIFEST").Body, &full); err != nil {
+		t.Fatal(err)
+	}
+	if compact.Files != nil {
+		t.Errorf("compact manifest lists files: %v", compact.Files)
+	}
+	if compact.ABI != "FreeBSD:13:amd64" || compact.Origin != "sysutils/qri" {
+		t.Errorf("manifest abi/origin mismatch: %s %s", compact.ABI, compact.Origin)
+	}
+	if got := strings.Join(compact.Licenses, ","); got != "GPL-3.0" {
+		t.Errorf("licenses mismatch: %s", got)
+	}
+	sum := fmt.Sprintf("1$%x", sha256.Sum256([]byte(testBin)))
+	if got := full.Files["/usr/local/bin/qri"]; got != sum {
+		t.Errorf("file checksum mismatch. got: %s, want: %s", got, sum)
+	}
+	if full.Flatsize != len(testBin) {
+		t.Errorf("flatsize mismatch: %d", full.Flatsize)
+	}
+}
+
+func TestPackageLicense(t *testing.T) {
+	cases := map[string]string{
+		"MIT": "MIT",
+		"":    "Unknown",
+	}
+	for license, want := range cases {
+		if got := (Package{License: license}).license(); got != want {
+			t.Errorf("%q: license mismatch. got: %q, want: %q", license, got, want)
+		}
+	}
+}
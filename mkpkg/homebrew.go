@@ -0,0 +1,179 @@
+package mkpkg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// HomebrewConfig encapsulates configuration details for generating homebrew
+// formulae & casks from built packages
+type HomebrewConfig struct {
+	// template for the url packages are published at. Templates have access
+	// to all Package fields, and File, the package file name, eg:
+	// https://github.com/qri-io/qri/releases/download/{{ .Version }}/{{ .File }}
+	URL string
+	// path to a local tap checkout. formulae are written to [TapPath]/Formula
+	// and casks to [TapPath]/Casks. Default is homebrew in the output directory
+	TapPath string
+}
+
+// tapPath returns the configured tap checkout, defaulting to homebrew in the
+// output directory
+func (c HomebrewConfig) tapPath(outDir string) string {
+	if c.TapPath == "" {
+		return filepath.Join(outDir, "homebrew")
+	}
+	return c.TapPath
+}
+
+// homebrewArchs maps GOARCH values to homebrew's architecture blocks.
+// homebrew doesn't run on other architectures
+var homebrewArchs = map[string]string{
+	"amd64": "on_intel",
+	"arm64": "on_arm",
+}
+
+// homebrewFormula writes a formula that installs the binary from the linux
+// tarballs in artifacts, for each architecture homebrew supports
+func (p Package) homebrewFormula(artifacts []Artifact) error {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return err
+	}
+	urls, err := p.homebrewURLs(artifacts, "linux", "tar.gz")
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "class %s < Formula\n", homebrewClass(p.BinName))
+	fmt.Fprintf(buf, "  desc %s\n", rubyString(p.homebrewDesc()))
+	if p.SiteURL != "" {
+		fmt.Fprintf(buf, "  homepage %s\n", rubyString(p.SiteURL))
+	}
+	fmt.Fprintf(buf, "  version %s\n", rubyString(p.pkgVersion()))
+	if p.License != "" {
+		fmt.Fprintf(buf, "  license %s\n", rubyString(p.License))
+	}
+	fmt.Fprintf(buf, "\n  on_linux do\n")
+	writeHomebrewURLs(buf, "    ", urls, false)
+	fmt.Fprintf(buf, "  end\n")
+	fmt.Fprintf(buf, "\n  def install\n")
+	fmt.Fprintf(buf, "    bin.install %s\n", rubyString(p.BinName))
+	fmt.Fprintf(buf, "  end\n")
+	fmt.Fprintf(buf, "\n  test do\n")
+	fmt.Fprintf(buf, "    assert_predicate bin/%s, :executable?\n", rubyString(p.BinName))
+	fmt.Fprintf(buf, "  end\n")
+	fmt.Fprintf(buf, "end\n")
+
+	return p.writeHomebrew(outDir, "Formula", buf.String())
+}
+
+// homebrewCask writes a cask that installs the darwin .pkg files in
+// artifacts, for each architecture homebrew supports
+func (p Package) homebrewCask(artifacts []Artifact) error {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return err
+	}
+	urls, err := p.homebrewURLs(artifacts, "darwin", "pkg")
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "cask %s do\n", rubyString(p.BinName))
+	fmt.Fprintf(buf, "  version %s\n\n", rubyString(p.pkgVersion()))
+	// each architecture installs its own package
+	writeHomebrewURLs(buf, "  ", urls, true)
+	fmt.Fprintf(buf, "\n  name %s\n", rubyString(p.Name))
+	fmt.Fprintf(buf, "  desc %s\n", rubyString(p.homebrewDesc()))
+	if p.SiteURL != "" {
+		fmt.Fprintf(buf, "  homepage %s\n", rubyString(p.SiteURL))
+	}
+	fmt.Fprintf(buf, "\n  uninstall pkgutil: %s\n", rubyString(p.Identifier))
+	fmt.Fprintf(buf, "end\n")
+
+	return p.writeHomebrew(outDir, "Casks", buf.String())
+}
+
+// homebrewURLs returns the published packages of goos & format that
+// homebrew can install
+func (p Package) homebrewURLs(artifacts []Artifact, goos, format string) ([]publishedArtifact, error) {
+	if p.Homebrew.URL == "" {
+		return nil, fmt.Errorf("Homebrew.URL is required")
+	}
+	published, err := p.publishedArtifacts(p.Homebrew.URL, artifacts, goos, format)
+	if err != nil {
+		return nil, err
+	}
+	var urls []publishedArtifact
+	for _, a := range published {
+		if _, ok := homebrewArchs[a.Arch]; ok {
+			urls = append(urls, a)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("homebrew requires a %s %s package for amd64 or arm64", goos, format)
+	}
+	return urls, nil
+}
+
+// writeHomebrewURLs writes the url & sha256 of each package within its
+// architecture block, and the package file name to install if pkg is true
+func writeHomebrewURLs(buf *bytes.Buffer, indent string, urls []publishedArtifact, pkg bool) {
+	for _, a := range urls {
+		fmt.Fprintf(buf, "%s%s do\n", indent, homebrewArchs[a.Arch])
+		fmt.Fprintf(buf, "%s  url %s\n", indent, rubyString(a.URL))
+		fmt.Fprintf(buf, "%s  sha256 %s\n", indent, rubyString(a.SHA256))
+		if pkg {
+			fmt.Fprintf(buf, "%s  pkg %s\n", indent, rubyString(filepath.Base(a.Path)))
+		}
+		fmt.Fprintf(buf, "%send\n", indent)
+	}
+}
+
+// writeHomebrew writes a formula or cask named for the binary into dir of
+// the tap checkout
+func (p Package) writeHomebrew(outDir, dir, body string) error {
+	dir = filepath.Join(p.Homebrew.tapPath(outDir), dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, p.BinName+".rb"), []byte(body), 0644)
+}
+
+// homebrewDesc returns a description in homebrew style, which omits a
+// trailing period
+func (p Package) homebrewDesc() string {
+	return strings.TrimSuffix(p.summary(), ".")
+}
+
+// homebrewClass converts a formula name to the ruby class homebrew expects,
+// eg: "my-tool" becomes "MyTool"
+func homebrewClass(name string) string {
+	buf := &strings.Builder{}
+	upper := true
+	for _, r := range name {
+		if r == '-' || r == '_' || r == '.' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// rubyString quotes s as a ruby string literal without interpolation
+func rubyString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `#{`, `\#{`).Replace(s) + `"`
+}
@@ -0,0 +1,171 @@
+package mkpkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestArtifact writes a fake built package named file into the output
+// directory, returning the artifact describing it
+func writeTestArtifact(t *testing.T, p Package, file, goos, format, arch string) Artifact {
+	t.Helper()
+	if err := os.MkdirAll(p.OutDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(p.OutDir, file)
+	if err := ioutil.WriteFile(path, []byte("fake "+file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewArtifact(p, path, format, goos, arch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestHomebrewFormula(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Homebrew.URL = "https://example.com/{{ .Version }}/{{ .File }}"
+	artifacts := []Artifact{
+		writeTestArtifact(t, p, "qri-v0.5.0-linux-arm64.tar.gz", "linux", "tar.gz", "arm64"),
+		writeTestArtifact(t, p, "qri-v0.5.0-linux-amd64.tar.gz", "linux", "tar.gz", "amd64"),
+		// homebrew doesn't run on 32 bit arm, and doesn't use debs
+		writeTestArtifact(t, p, "qri-v0.5.0-linux-arm.tar.gz", "linux", "tar.gz", "arm"),
+		writeTestArtifact(t, p, "qri_0.5.0_amd64.deb", "linux", "deb", "amd64"),
+	}
+
+	if err := p.homebrewFormula(artifacts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p.OutDir, "homebrew", "Formula", "qri.rb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `class Qri < Formula
+  desc "qri is a web of datasets second paragraph"
+  homepage "https://qri.io"
+  version "0.5.0"
+  license "GPL-3.0"
+
+  on_linux do
+    on_intel do
+      url "https://example.com/v0.5.0/qri-v0.5.0-linux-amd64.tar.gz"
+      sha256 "` + artifacts[1].SHA256 + `"
+    end
+    on_arm do
+      url "https://example.com/v0.5.0/qri-v0.5.0-linux-arm64.tar.gz"
+      sha256 "` + artifacts[0].SHA256 + `"
+    end
+  end
+
+  def install
+    bin.install "qri"
+  end
+
+  test do
+    assert_predicate bin/"qri", :executable?
+  end
+end
+`
+	if string(data) != want {
+		t.Errorf("formula mismatch.\ngot:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestHomebrewCask(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Homebrew.URL = "https://example.com/{{ .File }}"
+	p.Homebrew.TapPath = filepath.Join(p.OutDir, "tap")
+	pkg := writeTestArtifact(t, p, p.darwinPkgName(), "darwin", "pkg", "amd64")
+	p.Darwin.Arch = "arm64"
+	armPkg := writeTestArtifact(t, p, p.darwinPkgName(), "darwin", "pkg", "arm64")
+
+	if err := p.homebrewCask([]Artifact{armPkg, pkg}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p.OutDir, "tap", "Casks", "qri.rb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lines := range []string{
+		`cask "qri" do`,
+		`  on_intel do
+    url "https://example.com/Qri%20CLI-amd64.pkg"
+    sha256 "` + pkg.SHA256 + `"
+    pkg "Qri CLI-amd64.pkg"
+  end
+  on_arm do
+    url "https://example.com/Qri%20CLI-arm64.pkg"
+    sha256 "` + armPkg.SHA256 + `"
+    pkg "Qri CLI-arm64.pkg"
+  end`,
+		`  uninstall pkgutil: "io.qri.cli"`,
+	} {
+		if !strings.Contains(string(data), lines+"\n") {
+			t.Errorf("cask missing %q:\n%s", lines, data)
+		}
+	}
+
+	// casks only describe the architectures that were built
+	if err := p.homebrewCask([]Artifact{pkg}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadFile(filepath.Join(p.OutDir, "tap", "Casks", "qri.rb")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "on_arm") {
+		t.Errorf("cask has an arm block without an arm package:\n%s", data)
+	}
+}
+
+func TestHomebrewErrors(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	tarball := writeTestArtifact(t, p, "qri-v0.5.0-linux-386.tar.gz", "linux", "tar.gz", "386")
+	if err := p.homebrewFormula([]Artifact{tarball}); err == nil {
+		t.Error("expected an error without Homebrew.URL")
+	}
+	p.Homebrew.URL = "https://example.com/{{ .File }}"
+	if err := p.homebrewFormula(nil); err == nil {
+		t.Error("expected an error without tarballs")
+	}
+	if err := p.homebrewFormula([]Artifact{tarball}); err == nil {
+		t.Error("expected an error without a tarball homebrew supports")
+	}
+	if err := p.homebrewFormula([]Artifact{tarball, tarball}); err == nil {
+		t.Error("expected an error for two tarballs of one architecture")
+	}
+}
+
+func TestHomebrewClass(t *testing.T) {
+	cases := map[string]string{
+		"qri":          "Qri",
+		"my-tool":      "MyTool",
+		"go_tool.v2":   "GoToolV2",
+		"already-Caps": "AlreadyCaps",
+	}
+	for in, want := range cases {
+		if got := homebrewClass(in); got != want {
+			t.Errorf("%s: class mismatch. got: %s, want: %s", in, got, want)
+		}
+	}
+}
+
+func TestRubyString(t *testing.T) {
+	cases := map[string]string{
+		`plain`:         `"plain"`,
+		`say "hi"`:      `"say \"hi\""`,
+		`back\slash`:    `"back\\slash"`,
+		`#{system "x"}`: `"\#{system \"x\"}"`,
+	}
+	for in, want := range cases {
+		if got := rubyString(in); got != want {
+			t.Errorf("%s: mismatch. got: %s, want: %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package mkpkg
+
+import (
+	"runtime"
+	"strings"
+)
+
+// LinuxConfig encapsulates configuration details for creating linux packages
+type LinuxConfig struct {
+	// Path to compatible linux binary executable to install
+	BinPath string
+	// installation prefix the binary is placed under, as in [Prefix]/bin/[BinName].
+	// Default is /usr
+	Prefix string
+	// target architecture using go's GOARCH naming, eg: amd64, 386, arm64.
+	// Default is the architecture mkpkg is running on
+	Arch string
+	// package maintainer, eg: "Qri, Inc. <sparkle_pony@qri.io>"
+	Maintainer string
+	// package release number, incremented when repackaging the same version.
+	// Default is 1
+	Release string
+	// rpm package group, eg: "Applications/System". Default is "Unspecified"
+	Group string
+	// path to a PEM encoded RSA private key to sign .apk packages with, eg:
+	// ~/.abuild/sparkle_pony@qri.io-5d1e3f2a.rsa. The public key must be
+	// installed on the target as /etc/apk/keys/[key file name].pub.
+	// Packages are left unsigned when empty
+	APKSigningKey string
+	// path to a png or svg icon for desktop integration. Required for AppImages
+	IconPath string
+	// freedesktop.org menu categories the application belongs to.
+	// Default is [Utility]
+	DesktopCategories []string
+	// true if the binary is a graphical application. Command line programs
+	// are run in a terminal when launched from the desktop
+	GUI bool
+	// path to an AppImage type 2 runtime for Arch to prepend to the AppImage
+	// filesystem, eg: runtime-x86_64 from a release of
+	// https://github.com/AppImage/type2-runtime. Required for AppImages.
+	// mkpkg doesn't download runtimes, so the runtime a package is built
+	// with is one you've chosen & verified
+	AppImageRuntimePath string
+}
+
+// prefix returns the configured install prefix, or the default of /usr
+func (c LinuxConfig) prefix() string {
+	if c.Prefix == "" {
+		return "/usr"
+	}
+	return "/" + strings.Trim(c.Prefix, "/")
+}
+
+// arch returns the configured GOARCH-style architecture, defaulting to the
+// architecture of the running process
+func (c LinuxConfig) arch() string {
+	if c.Arch == "" {
+		return runtime.GOARCH
+	}
+	return c.Arch
+}
+
+// release returns the configured package release, defaulting to 1
+func (c LinuxConfig) release() string {
+	if c.Release == "" {
+		return "1"
+	}
+	return c.Release
+}
+
+// group returns the configured rpm group, defaulting to Unspecified
+func (c LinuxConfig) group() string {
+	if c.Group == "" {
+		return "Unspecified"
+	}
+	return c.Group
+}
+
+// license returns the configured license, defaulting to Unknown
+func (p Package) license() string {
+	if p.License != "" {
+		return p.License
+	}
+	return "Unknown"
+}
+
+// desktopCategories returns the configured menu categories, defaulting to
+// Utility
+func (c LinuxConfig) desktopCategories() []string {
+	if len(c.DesktopCategories) == 0 {
+		return []string{"Utility"}
+	}
+	return c.DesktopCategories
+}
+
+// maintainer returns the configured maintainer, falling back to the package name
+func (p Package) maintainer() string {
+	if p.Linux.Maintainer != "" {
+		return p.Linux.Maintainer
+	}
+	return p.Name
+}
+
+// pkgVersion returns the package version without a "v" prefix, which is the
+// format package managers expect
+func (p Package) pkgVersion() string {
+	return strings.TrimPrefix(p.Version, "v")
+}
+
+// summary returns the description collapsed to a single line, falling back
+// to the package name
+func (p Package) summary() string {
+	if desc := strings.Join(strings.Fields(p.Description), " "); desc != "" {
+		return desc
+	}
+	return p.Name
+}
@@ -3,7 +3,9 @@ package mkpkg
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"text/template"
 )
 
@@ -21,35 +23,205 @@ type Package struct {
 	Identifier string
 	// semantic version identifier with "v" prefix. eg: v1.0.0
 	Version string
+	// SPDX license identifier, eg: "Apache-2.0". Packages that require a
+	// license record "Unknown" when empty
+	License string
+	// path to a license file to include in archive packages, eg: LICENSE
+	LicensePath string
+	// path to a readme file to include in archive packages, eg: readme.md
+	ReadmePath string
+	// directory to write packages to. Default is pkg
+	OutDir string
+	// Path to the binary for each of Targets, as a template with access to
+	// package fields and the target's OS, Arch & executable Ext, eg:
+	// dist/{{.OS}}_{{.Arch}}/qri{{.Ext}}
+	BinPath string
+	// operating systems, architectures & formats created by MakeAll
+	Targets []Target
 	// Darwin-Specific Configuration Details
 	Darwin DarwinConfig
 	// MSI-Specific Configuration Details
 	MSI MSIConfig
+	// NSIS-Specific Configuration Details
+	NSIS NSISConfig
+	// Portable windows zip Configuration Details
+	Zip ZipConfig
+	// Linux-Specific Configuration Details
+	Linux LinuxConfig
+	// Snap-Specific Configuration Details
+	Snap SnapConfig
+	// Flatpak-Specific Configuration Details
+	Flatpak FlatpakConfig
+	// FreeBSD-Specific Configuration Details
+	FreeBSD FreeBSDConfig
+	// Homebrew formula & cask generation details
+	Homebrew HomebrewConfig
+	// Scoop, winget & chocolatey manifest generation details
+	WindowsManifests WindowsManifestsConfig
+	// Nix derivation generation details
+	Nix NixConfig
 }
 
 // MakeDarwin creates an os X .pkg
 func (p Package) MakeDarwin() error {
-	return p.darwinPKG()
+	_, err := p.darwinPKG()
+	return err
 }
 
-// environ returns commonly required details for the environment mkpkg is operating in
-func (p Package) environ() (cwd, version string, err error) {
-	cwd, err = os.Getwd()
+// MakeMSI creates a windows .msi installer
+func (p Package) MakeMSI() error {
+	_, err := p.windowsMSI()
+	return err
+}
+
+// MakeNSIS creates a windows setup .exe installer with NSIS
+func (p Package) MakeNSIS() error {
+	_, err := p.windowsNSIS()
+	return err
+}
+
+// MakeWindowsZip creates a portable windows .zip with scripts that install
+// the binary for the current user
+func (p Package) MakeWindowsZip() error {
+	_, err := p.windowsZip()
+	return err
+}
+
+// MakeDeb creates a debian .deb package
+func (p Package) MakeDeb() error {
+	_, err := p.linuxDeb()
+	return err
+}
+
+// MakeRPM creates a redhat .rpm package
+func (p Package) MakeRPM() error {
+	_, err := p.linuxRPM()
+	return err
+}
+
+// MakeAPK creates an alpine .apk package
+func (p Package) MakeAPK() error {
+	_, err := p.linuxAPK()
+	return err
+}
+
+// MakePacman creates an arch linux .pkg.tar.zst package, and a matching
+// PKGBUILD-[arch]
+func (p Package) MakePacman() error {
+	_, err := p.linuxPacman()
+	return err
+}
+
+// MakeAppImage creates a linux .AppImage that runs without installation
+func (p Package) MakeAppImage() error {
+	_, err := p.linuxAppImage()
+	return err
+}
+
+// MakeSnap creates a linux .snap package, and a matching snapcraft.yaml in
+// snap-[arch]/snap
+func (p Package) MakeSnap() error {
+	_, err := p.linuxSnap()
+	return err
+}
+
+// MakeFlatpak creates a flatpak manifest & AppStream metainfo in
+// flatpak-[arch], and a .flatpak bundle if configured
+func (p Package) MakeFlatpak() error {
+	_, err := p.linuxFlatpak()
+	return err
+}
+
+// MakeTarball creates a linux .tar.gz archive with an install script
+func (p Package) MakeTarball() error {
+	_, err := p.linuxTarball()
+	return err
+}
+
+// MakeFreeBSD creates a FreeBSD .pkg package
+func (p Package) MakeFreeBSD() error {
+	_, err := p.freebsdPkg()
+	return err
+}
+
+// MakeHomebrewFormula writes a homebrew formula for the linux tarballs in
+// artifacts, as returned by MakeAll or RunJobs
+func (p Package) MakeHomebrewFormula(artifacts []Artifact) error {
+	return p.homebrewFormula(artifacts)
+}
+
+// MakeHomebrewCask writes a homebrew cask for the darwin .pkg files in
+// artifacts
+func (p Package) MakeHomebrewCask(artifacts []Artifact) error {
+	return p.homebrewCask(artifacts)
+}
+
+// MakeNix writes a nix derivation & flake for the linux tarballs in
+// artifacts, with a package for each architecture
+func (p Package) MakeNix(artifacts []Artifact) error {
+	return p.linuxNix(artifacts)
+}
+
+// MakeScoop writes a scoop manifest for the windows zips in artifacts
+func (p Package) MakeScoop(artifacts []Artifact) error {
+	return p.windowsScoop(artifacts)
+}
+
+// MakeWinget writes a winget manifest for the windows .msi files in
+// artifacts, with an installer for each architecture
+func (p Package) MakeWinget(artifacts []Artifact) error {
+	return p.windowsWinget(artifacts)
+}
+
+// MakeChocolatey writes a chocolatey .nuspec, and packs a .nupkg that
+// installs the windows .msi files in artifacts
+func (p Package) MakeChocolatey(artifacts []Artifact) error {
+	return p.windowsChocolatey(artifacts)
+}
+
+// environ returns commonly required details for the environment mkpkg is
+// operating in. outDir is the absolute output directory, created if it
+// doesn't exist
+func (p Package) environ() (outDir, version string, err error) {
+	outDir, err = filepath.Abs(p.outDir())
 	if err != nil {
 		return
 	}
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		return
+	}
 	version = p.Version
 	return
 }
 
+// outDir returns the configured output directory, defaulting to pkg
+func (p Package) outDir() string {
+	if p.OutDir == "" {
+		return "pkg"
+	}
+	return p.OutDir
+}
+
+// workDir creates a temporary directory for a build to assemble files in.
+// callers must remove it when finished. Builds each use their own work
+// directory, so any number of them can run at once
+func workDir(name string) (string, error) {
+	return ioutil.TempDir("", "mkpkg-"+name+"-")
+}
+
 // execTemplate executes a template string against package info
 func (p Package) execTemplate(tmpl string) (string, error) {
+	return renderTemplate(tmpl, p)
+}
+
+// renderTemplate executes a template string against arbitrary data
+func renderTemplate(tmpl string, data interface{}) (string, error) {
 	buf := &bytes.Buffer{}
 	t, err := template.New("template").Parse(tmpl)
 	if err != nil {
 		return "", err
 	}
-	if err = t.Execute(buf, p); err != nil {
+	if err = t.Execute(buf, data); err != nil {
 		return "", err
 	}
 	return buf.String(), nil
@@ -0,0 +1,117 @@
+package mkpkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBin is the body of the fake binary packaged by tests
+const testBin = "#!/bin/sh\necho qri\n"
+
+// testPackage returns a package for a fake binary, with output written to a
+// temporary directory. call the returned func to remove it
+func testPackage(t *testing.T) (Package, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mkpkg-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(body), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	bin := write("qri", testBin)
+	exe := write("qri.exe", testBin)
+
+	p := Package{
+		Name:        "Qri CLI",
+		BinName:     "qri",
+		Description: "qri is a web of datasets\n\nsecond paragraph",
+		SiteURL:     "https://qri.io",
+		Identifier:  "io.qri.cli",
+		Version:     "v0.5.0",
+		License:     "GPL-3.0",
+		LicensePath: write("LICENSE", "GNU GENERAL PUBLIC LICENSE\n"),
+		ReadmePath:  write("readme.md", "# qri\n"),
+		OutDir:      filepath.Join(dir, "pkg"),
+		Darwin:      DarwinConfig{BinPath: bin, WelcomeMsg: "hello"},
+		Linux: LinuxConfig{
+			BinPath:    bin,
+			Arch:       "amd64",
+			Maintainer: "Qri, Inc. <sparkle_pony@qri.io>",
+		},
+		FreeBSD: FreeBSDConfig{BinPath: bin, Arch: "amd64"},
+		MSI:     MSIConfig{BinPath: exe, Arch: "amd64"},
+		NSIS:    NSISConfig{BinPath: exe, Arch: "amd64"},
+		Zip:     ZipConfig{BinPath: exe, Arch: "amd64"},
+	}
+	return p, func() { os.RemoveAll(dir) }
+}
+
+// tarEntry is a file read back out of a tar archive
+type tarEntry struct {
+	Header *tar.Header
+	Body   []byte
+}
+
+// readTar reads every entry of a tar stream, returning entries in archive
+// order
+func readTar(t *testing.T, r io.Reader) []tarEntry {
+	t.Helper()
+	var entries []tarEntry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, tarEntry{Header: hdr, Body: body})
+	}
+}
+
+// readTarGz reads every entry of a gzip compressed tar stream
+func readTarGz(t *testing.T, data []byte) []tarEntry {
+	t.Helper()
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readTar(t, gr)
+}
+
+// tarNames lists the names of entries
+func tarNames(entries []tarEntry) []string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Header.Name
+	}
+	return names
+}
+
+// tarFile returns the named entry, failing the test if it's missing
+func tarFile(t *testing.T, entries []tarEntry, name string) tarEntry {
+	t.Helper()
+	for _, e := range entries {
+		if e.Header.Name == name {
+			return e
+		}
+	}
+	t.Fatalf("archive has no entry %q. entries: %v", name, tarNames(entries))
+	return tarEntry{}
+}
@@ -0,0 +1,122 @@
+package mkpkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NixConfig encapsulates configuration details for generating a nix
+// derivation & flake that install the linux tarballs
+type NixConfig struct {
+	// template for the url tarballs are published at. Templates have
+	// access to all Package fields, and File, the tarball file name, eg:
+	// https://github.com/qri-io/qri/releases/download/{{ .Version }}/{{ .File }}
+	URL string
+}
+
+// nixSystems maps GOARCH values to nix linux system names
+var nixSystems = map[string]string{
+	"386":   "i686-linux",
+	"amd64": "x86_64-linux",
+	"arm":   "armv7l-linux",
+	"arm64": "aarch64-linux",
+}
+
+// linuxNix writes default.nix & flake.nix for the linux tarballs in
+// artifacts, with a package for each architecture's nix system
+func (p Package) linuxNix(artifacts []Artifact) error {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return err
+	}
+	if p.Nix.URL == "" {
+		return fmt.Errorf("Nix.URL is required")
+	}
+	published, err := p.publishedArtifacts(p.Nix.URL, artifacts, "linux", "tar.gz")
+	if err != nil {
+		return err
+	}
+
+	sources := &bytes.Buffer{}
+	var systems []string
+	for _, a := range published {
+		system, ok := nixSystems[a.Arch]
+		if !ok {
+			return fmt.Errorf("unsupported nix architecture: %s", a.Arch)
+		}
+		// nix expects hashes in SRI form
+		digest, err := hex.DecodeString(a.SHA256)
+		if err != nil {
+			return err
+		}
+		hash := "sha256-" + base64.StdEncoding.EncodeToString(digest)
+		fmt.Fprintf(sources, "    %s = fetchurl {\n", nixString(system))
+		fmt.Fprintf(sources, "      url = %s;\n", nixString(a.URL))
+		fmt.Fprintf(sources, "      hash = %s;\n", nixString(hash))
+		fmt.Fprintf(sources, "    };\n")
+		systems = append(systems, nixString(system))
+	}
+	sort.Strings(systems)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "{ lib, stdenv, fetchurl }:\n\n")
+	fmt.Fprintf(buf, "let\n")
+	fmt.Fprintf(buf, "  sources = {\n")
+	buf.Write(sources.Bytes())
+	fmt.Fprintf(buf, "  };\n")
+	fmt.Fprintf(buf, "  system = stdenv.hostPlatform.system;\n")
+	fmt.Fprintf(buf, "in\n")
+	fmt.Fprintf(buf, "stdenv.mkDerivation {\n")
+	fmt.Fprintf(buf, "  pname = %s;\n", nixString(p.BinName))
+	fmt.Fprintf(buf, "  version = %s;\n\n", nixString(p.pkgVersion()))
+	fmt.Fprintf(buf, "  src = sources.${system} or (throw \"unsupported system: ${system}\");\n\n")
+	fmt.Fprintf(buf, "  dontConfigure = true;\n")
+	fmt.Fprintf(buf, "  dontBuild = true;\n\n")
+	fmt.Fprintf(buf, "  installPhase = ''\n")
+	fmt.Fprintf(buf, "    runHook preInstall\n")
+	fmt.Fprintf(buf, "    install -Dm755 %s $out/bin/%s\n", p.BinName, p.BinName)
+	fmt.Fprintf(buf, "    runHook postInstall\n")
+	fmt.Fprintf(buf, "  '';\n\n")
+	fmt.Fprintf(buf, "  meta = {\n")
+	fmt.Fprintf(buf, "    description = %s;\n", nixString(p.summary()))
+	if desc := strings.TrimSpace(p.Description); desc != "" {
+		fmt.Fprintf(buf, "    longDescription = %s;\n", nixString(desc))
+	}
+	if p.SiteURL != "" {
+		fmt.Fprintf(buf, "    homepage = %s;\n", nixString(p.SiteURL))
+	}
+	if p.License != "" {
+		fmt.Fprintf(buf, "    license = lib.getLicenseFromSpdxId %s;\n", nixString(p.License))
+	}
+	fmt.Fprintf(buf, "    platforms = builtins.attrNames sources;\n")
+	fmt.Fprintf(buf, "    sourceProvenance = [ lib.sourceTypes.binaryNativeCode ];\n")
+	fmt.Fprintf(buf, "    mainProgram = %s;\n", nixString(p.BinName))
+	fmt.Fprintf(buf, "  };\n")
+	fmt.Fprintf(buf, "}\n")
+
+	flake := &bytes.Buffer{}
+	fmt.Fprintf(flake, "{\n")
+	fmt.Fprintf(flake, "  description = %s;\n\n", nixString(p.summary()))
+	fmt.Fprintf(flake, "  inputs.nixpkgs.url = \"github:NixOS/nixpkgs/nixos-unstable\";\n\n")
+	fmt.Fprintf(flake, "  outputs = { self, nixpkgs }: {\n")
+	fmt.Fprintf(flake, "    packages = nixpkgs.lib.genAttrs [ %s ] (system: {\n", strings.Join(systems, " "))
+	fmt.Fprintf(flake, "      default = nixpkgs.legacyPackages.${system}.callPackage ./default.nix { };\n")
+	fmt.Fprintf(flake, "    });\n")
+	fmt.Fprintf(flake, "  };\n")
+	fmt.Fprintf(flake, "}\n")
+
+	return writeDataFiles(map[string]string{
+		"default.nix": buf.String(),
+		"flake.nix":   flake.String(),
+	}, filepath.Join(outDir, "nix"))
+}
+
+// nixString quotes s as a nix string literal without interpolation
+func nixString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `${`, `\${`, "\n", `\n`).Replace(s) + `"`
+}
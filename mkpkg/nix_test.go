@@ -0,0 +1,112 @@
+package mkpkg
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinuxNix(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Nix.URL = "https://example.com/{{ .Version }}/{{ .File }}"
+	artifacts := []Artifact{
+		writeTestArtifact(t, p, "qri-v0.5.0-linux-amd64.tar.gz", "linux", "tar.gz", "amd64"),
+		writeTestArtifact(t, p, "qri-v0.5.0-linux-arm64.tar.gz", "linux", "tar.gz", "arm64"),
+	}
+	sri := func(a Artifact) string {
+		digest, err := hex.DecodeString(a.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "sha256-" + base64.StdEncoding.EncodeToString(digest)
+	}
+
+	if err := p.linuxNix(artifacts); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(p.OutDir, "nix")
+	drv, err := ioutil.ReadFile(filepath.Join(dir, "default.nix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := `  sources = {
+    "x86_64-linux" = fetchurl {
+      url = "https://example.com/v0.5.0/qri-v0.5.0-linux-amd64.tar.gz";
+      hash = "` + sri(artifacts[0]) + `";
+    };
+    "aarch64-linux" = fetchurl {
+      url = "https://example.com/v0.5.0/qri-v0.5.0-linux-arm64.tar.gz";
+      hash = "` + sri(artifacts[1]) + `";
+    };
+  };
+`
+	if !strings.Contains(string(drv), sources) {
+		t.Errorf("default.nix sources mismatch:\n%s", drv)
+	}
+	for _, line := range []string{
+		`  pname = "qri";`,
+		`  version = "0.5.0";`,
+		`  src = sources.${system} or (throw "unsupported system: ${system}");`,
+		`    install -Dm755 qri $out/bin/qri`,
+		`    longDescription = "qri is a web of datasets\n\nsecond paragraph";`,
+		`    license = lib.getLicenseFromSpdxId "GPL-3.0";`,
+		`    platforms = builtins.attrNames sources;`,
+	} {
+		if !strings.Contains(string(drv), line+"\n") {
+			t.Errorf("default.nix missing %q:\n%s", line, drv)
+		}
+	}
+
+	flake, err := ioutil.ReadFile(filepath.Join(dir, "flake.nix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(flake), `packages = nixpkgs.lib.genAttrs [ "aarch64-linux" "x86_64-linux" ] (system: {`) {
+		t.Errorf("flake.nix missing package outputs:\n%s", flake)
+	}
+
+	if _, err := exec.LookPath("nix-instantiate"); err != nil {
+		t.Log("nix-instantiate not found, skipping parse checks")
+		return
+	}
+	for _, name := range []string{"default.nix", "flake.nix"} {
+		if out, err := exec.Command("nix-instantiate", "--parse", filepath.Join(dir, name)).CombinedOutput(); err != nil {
+			t.Errorf("%s doesn't parse: %s\n%s", name, err, out)
+		}
+	}
+}
+
+func TestLinuxNixErrors(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	tarball := writeTestArtifact(t, p, "qri-v0.5.0-linux-s390x.tar.gz", "linux", "tar.gz", "s390x")
+	if err := p.linuxNix([]Artifact{tarball}); err == nil {
+		t.Error("expected an error without Nix.URL")
+	}
+	p.Nix.URL = "https://example.com/{{ .File }}"
+	if err := p.linuxNix(nil); err == nil {
+		t.Error("expected an error without tarballs")
+	}
+	if err := p.linuxNix([]Artifact{tarball}); err == nil {
+		t.Error("expected an error for an unsupported architecture")
+	}
+}
+
+func TestNixString(t *testing.T) {
+	cases := map[string]string{
+		`plain`:        `"plain"`,
+		`say "hi"`:     `"say \"hi\""`,
+		`${pkgs.evil}`: `"\${pkgs.evil}"`,
+		"two\nlines":   `"two\nlines"`,
+	}
+	for in, want := range cases {
+		if got := nixString(in); got != want {
+			t.Errorf("%q: mismatch. got: %s, want: %s", in, got, want)
+		}
+	}
+}
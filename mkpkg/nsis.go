@@ -0,0 +1,228 @@
+package mkpkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// NSISConfig encapsulates configuration details for creating an NSIS setup
+// executable
+type NSISConfig struct {
+	// Path to compatible windows binary executable to install
+	BinPath string
+	// target architecture using go's GOARCH naming, one of: 386, amd64.
+	// Default is the architecture mkpkg is running on
+	Arch string
+	// publisher shown in Add/Remove Programs. Default is Name
+	Publisher string
+	// path to an .ico file to use as the installer & uninstaller icon
+	IconPath string
+}
+
+// arch returns the configured GOARCH-style architecture, defaulting to the
+// architecture of the running process
+func (c NSISConfig) arch() string {
+	if c.Arch == "" {
+		return runtime.GOARCH
+	}
+	return c.Arch
+}
+
+// nsisName returns the file name of the setup executable, eg:
+// qri-v0.5.0-windows-amd64-setup.exe
+func (p Package) nsisName() string {
+	return fmt.Sprintf("%s-%s-windows-%s-setup.exe", p.BinName, p.Version, p.NSIS.arch())
+}
+
+func (p Package) windowsNSIS() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	if arch := p.NSIS.arch(); arch != "386" && arch != "amd64" {
+		return "", fmt.Errorf("unknown arch for windows: %s", arch)
+	}
+
+	out := filepath.Join(outDir, p.nsisName())
+	nsisData, err := p.nsisData(out)
+	if err != nil {
+		return "", err
+	}
+
+	// Write out nsis data that is used by the packaging process.
+	work, err := workDir("nsis")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(work)
+	if err := writeDataFiles(nsisData, work); err != nil {
+		return "", err
+	}
+	if err := p.stageWindowsApp(filepath.Join(work, "app"), p.NSIS.BinPath); err != nil {
+		return "", err
+	}
+
+	if err := runDir(work, "makensis", "-V2", "installer.nsi"); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// nsisEscape escapes a string for use within a double-quoted NSIS string
+func nsisEscape(s string) string {
+	return strings.NewReplacer(
+		"$", "$$",
+		`"`, `$\"`,
+		"\r", "",
+		"\n", `$\r$\n`,
+	).Replace(s)
+}
+
+func (p Package) nsisData(outFile string) (map[string]string, error) {
+	publisher := p.NSIS.Publisher
+	if publisher == "" {
+		publisher = p.Name
+	}
+	programFiles := "$PROGRAMFILES"
+	if p.NSIS.arch() == "amd64" {
+		programFiles = "$PROGRAMFILES64"
+	}
+	identifier := p.Identifier
+	if identifier == "" {
+		identifier = p.BinName
+	}
+
+	data := map[string]string{}
+	assets := map[string]string{
+		"LICENSE.txt": p.LicensePath,
+		"product.ico": p.NSIS.IconPath,
+	}
+	for name, path := range assets {
+		if path == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data[name] = string(b)
+	}
+
+	installerNsi, err := renderTemplate(installerNsiTmpl, map[string]interface{}{
+		"Name":         nsisEscape(p.Name),
+		"BinName":      nsisEscape(p.BinName),
+		"Version":      nsisEscape(p.Version),
+		"Description":  nsisEscape(strings.TrimSpace(p.Description)),
+		"SiteURL":      nsisEscape(p.SiteURL),
+		"Publisher":    nsisEscape(publisher),
+		"Identifier":   nsisEscape(identifier),
+		"OutFile":      nsisEscape(outFile),
+		"ProgramFiles": programFiles,
+		"Is64":         p.NSIS.arch() == "amd64",
+		"License":      p.LicensePath != "",
+		"Icon":         p.NSIS.IconPath != "",
+	})
+	if err != nil {
+		return nil, err
+	}
+	data["installer.nsi"] = installerNsi
+	return data, nil
+}
+
+// installerNsiTmpl installs the binary to [ProgramFiles]\[BinName]\bin,
+// adds it to the system PATH, and registers an uninstaller with Add/Remove
+// Programs
+const installerNsiTmpl = `!include "MUI2.nsh"
+!include "x64.nsh"
+
+!define PRODUCT_NAME "{{ .Name }}"
+!define PRODUCT_VERSION "{{ .Version }}"
+!define PRODUCT_PUBLISHER "{{ .Publisher }}"
+!define UNINST_KEY "Software\Microsoft\Windows\CurrentVersion\Uninstall\{{ .Identifier }}"
+
+Unicode true
+Name "${PRODUCT_NAME}"
+OutFile "{{ .OutFile }}"
+InstallDir "{{ .ProgramFiles }}\{{ .BinName }}"
+InstallDirRegKey HKLM "${UNINST_KEY}" "InstallLocation"
+RequestExecutionLevel admin
+SetCompressor /SOLID lzma
+
+!define MUI_ABORTWARNING
+{{- if .Icon }}
+!define MUI_ICON "product.ico"
+!define MUI_UNICON "product.ico"
+{{- end }}
+{{- if .Description }}
+!define MUI_WELCOMEPAGE_TEXT "{{ .Description }}$\r$\n$\r$\nClick Next to continue."
+{{- end }}
+
+!insertmacro MUI_PAGE_WELCOME
+{{- if .License }}
+!insertmacro MUI_PAGE_LICENSE "LICENSE.txt"
+{{- end }}
+!insertmacro MUI_PAGE_DIRECTORY
+!insertmacro MUI_PAGE_INSTFILES
+!insertmacro MUI_PAGE_FINISH
+
+!insertmacro MUI_UNPAGE_CONFIRM
+!insertmacro MUI_UNPAGE_INSTFILES
+
+!insertmacro MUI_LANGUAGE "English"
+
+Function .onInit
+{{- if .Is64 }}
+  ${IfNot} ${RunningX64}
+    MessageBox MB_OK|MB_ICONSTOP "${PRODUCT_NAME} requires 64-bit windows."
+    Abort
+  ${EndIf}
+  SetRegView 64
+{{- end }}
+FunctionEnd
+
+Function un.onInit
+{{- if .Is64 }}
+  SetRegView 64
+{{- end }}
+FunctionEnd
+
+Section "Install"
+  SetOutPath "$INSTDIR\bin"
+  File "app\bin\{{ .BinName }}.exe"
+  SetOutPath "$INSTDIR"
+  WriteUninstaller "$INSTDIR\uninstall.exe"
+
+  ; Add/Remove Programs entry
+  WriteRegStr HKLM "${UNINST_KEY}" "DisplayName" "${PRODUCT_NAME}"
+  WriteRegStr HKLM "${UNINST_KEY}" "DisplayVersion" "${PRODUCT_VERSION}"
+  WriteRegStr HKLM "${UNINST_KEY}" "Publisher" "${PRODUCT_PUBLISHER}"
+  WriteRegStr HKLM "${UNINST_KEY}" "DisplayIcon" "$INSTDIR\bin\{{ .BinName }}.exe"
+  WriteRegStr HKLM "${UNINST_KEY}" "InstallLocation" "$INSTDIR"
+  WriteRegStr HKLM "${UNINST_KEY}" "UninstallString" "$\"$INSTDIR\uninstall.exe$\""
+  WriteRegStr HKLM "${UNINST_KEY}" "QuietUninstallString" "$\"$INSTDIR\uninstall.exe$\" /S"
+{{- if .SiteURL }}
+  WriteRegStr HKLM "${UNINST_KEY}" "URLInfoAbout" "{{ .SiteURL }}"
+{{- end }}
+  WriteRegDWORD HKLM "${UNINST_KEY}" "NoModify" 1
+  WriteRegDWORD HKLM "${UNINST_KEY}" "NoRepair" 1
+
+  ; Add $INSTDIR\bin to the system PATH
+  nsExec::ExecToLog "powershell -NoProfile -ExecutionPolicy Bypass -Command $\"$$d = '$INSTDIR\bin'; $$p = [Environment]::GetEnvironmentVariable('Path', 'Machine'); if (($$p -split ';') -notcontains $$d) { [Environment]::SetEnvironmentVariable('Path', $$p.TrimEnd(';') + ';' + $$d, 'Machine') }$\""
+SectionEnd
+
+Section "Uninstall"
+  ; Remove $INSTDIR\bin from the system PATH
+  nsExec::ExecToLog "powershell -NoProfile -ExecutionPolicy Bypass -Command $\"$$d = '$INSTDIR\bin'; $$p = ([Environment]::GetEnvironmentVariable('Path', 'Machine') -split ';' | Where-Object { $$_ -and $$_ -ne $$d }) -join ';'; [Environment]::SetEnvironmentVariable('Path', $$p, 'Machine')$\""
+
+  Delete "$INSTDIR\bin\{{ .BinName }}.exe"
+  RMDir "$INSTDIR\bin"
+  Delete "$INSTDIR\uninstall.exe"
+  RMDir "$INSTDIR"
+  DeleteRegKey HKLM "${UNINST_KEY}"
+SectionEnd
+`
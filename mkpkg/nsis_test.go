@@ -0,0 +1,91 @@
+package mkpkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNSISEscape(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"qri", "qri"},
+		{`say "hi"`, `say $\"hi$\"`},
+		{"$PATH", "$$PATH"},
+		{"line one\r\nline two", `line one$\r$\nline two`},
+	}
+	for _, c := range cases {
+		if got := nsisEscape(c.in); got != c.want {
+			t.Errorf("%q: got %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestNSISData(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Name = `Qri "CLI"`
+
+	out := filepath.Join(p.OutDir, p.nsisName())
+	data, err := p.nsisData(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["LICENSE.txt"] != "GNU GENERAL PUBLIC LICENSE\n" {
+		t.Errorf("expected LICENSE.txt asset, got: %q", data["LICENSE.txt"])
+	}
+	nsi := data["installer.nsi"]
+	for _, s := range []string{
+		`!define PRODUCT_NAME "Qri $\"CLI$\""`,
+		`!define PRODUCT_PUBLISHER "Qri $\"CLI$\""`,
+		`Uninstall\io.qri.cli"`,
+		`OutFile "` + out + `"`,
+		`InstallDir "$PROGRAMFILES64\qri"`,
+		`!insertmacro MUI_PAGE_LICENSE "LICENSE.txt"`,
+		`!define MUI_WELCOMEPAGE_TEXT "qri is a web of datasets$\r$\n$\r$\nsecond paragraph$\r$\n`,
+		"SetRegView 64",
+		`File "app\bin\qri.exe"`,
+	} {
+		if !strings.Contains(nsi, s) {
+			t.Errorf("installer.nsi missing %s", s)
+		}
+	}
+
+	p.NSIS.Arch = "386"
+	p.LicensePath = ""
+	data, err = p.nsisData(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsi = data["installer.nsi"]
+	if !strings.Contains(nsi, `InstallDir "$PROGRAMFILES\qri"`) || strings.Contains(nsi, "SetRegView 64") {
+		t.Errorf("32 bit installer should use 32 bit program files & registry")
+	}
+	if strings.Contains(nsi, "MUI_PAGE_LICENSE") {
+		t.Errorf("installer without a license shows the license page")
+	}
+}
+
+func TestWindowsNSIS(t *testing.T) {
+	if _, err := exec.LookPath("makensis"); err != nil {
+		t.Skip("makensis not found")
+	}
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path, err := p.windowsNSIS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("MZ")) {
+		t.Errorf("%s isn't a windows executable", path)
+	}
+}
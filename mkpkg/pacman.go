@@ -0,0 +1,196 @@
+package mkpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// pacmanArchs maps GOARCH values to arch linux architecture names
+var pacmanArchs = map[string]string{
+	"386":   "i686",
+	"amd64": "x86_64",
+	"arm":   "armv7h",
+	"arm64": "aarch64",
+}
+
+func (p Package) linuxPacman() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := pacmanArchs[p.Linux.arch()]
+	if !ok {
+		return "", fmt.Errorf("unsupported arch linux architecture: %s", p.Linux.arch())
+	}
+
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	binPath := strings.TrimPrefix(filepath.ToSlash(filepath.Join(p.Linux.prefix(), "bin", p.BinName)), "/")
+	files := []archiveFile{
+		{Name: binPath, Mode: 0755, Body: bin},
+	}
+	var license []byte
+	if p.LicensePath != "" {
+		if license, err = ioutil.ReadFile(p.LicensePath); err != nil {
+			return "", err
+		}
+		files = append(files, archiveFile{Name: fmt.Sprintf("usr/share/licenses/%s/LICENSE", p.BinName), Mode: 0644, Body: license})
+	}
+	files = withParentDirs(files)
+
+	size := 0
+	for _, f := range files {
+		size += len(f.Body)
+	}
+
+	// pacman expects package metadata to lead the archive, and .MTREE to
+	// describe every other entry
+	now := time.Now()
+	pkginfo := archiveFile{Name: ".PKGINFO", Mode: 0644, Body: []byte(p.pacmanPkgInfo(arch, size, now))}
+	files = append([]archiveFile{pkginfo}, files...)
+	mtree, err := pacmanMtree(files, now)
+	if err != nil {
+		return "", err
+	}
+	files = append([]archiveFile{{Name: ".MTREE", Mode: 0644, Body: mtree}}, files...)
+
+	f, err := os.Create(filepath.Join(outDir, fmt.Sprintf("%s-%s-%s-%s.pkg.tar.zst", p.BinName, p.pacmanVersion(), p.Linux.release(), arch)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return "", err
+	}
+	if err := writeTar(zw, files); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	// PKGBUILDs are named by architecture, eg: PKGBUILD-x86_64, so builds for
+	// different targets don't overwrite each other. use makepkg -p to build one
+	pkgbuild := p.pacmanPKGBUILD(arch, bin, license)
+	if err := ioutil.WriteFile(filepath.Join(outDir, "PKGBUILD-"+arch), []byte(pkgbuild), 0644); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// pacmanVersion returns the package version in a form acceptable to pacman,
+// which reserves "-" to separate the version from the release
+func (p Package) pacmanVersion() string {
+	return strings.Replace(p.pkgVersion(), "-", "_", -1)
+}
+
+// pacmanPkgInfo generates the contents of a .PKGINFO file
+func (p Package) pacmanPkgInfo(arch string, size int, builddate time.Time) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# Generated by mkpkg\n")
+	fmt.Fprintf(buf, "pkgname = %s\n", p.BinName)
+	fmt.Fprintf(buf, "pkgbase = %s\n", p.BinName)
+	fmt.Fprintf(buf, "pkgver = %s-%s\n", p.pacmanVersion(), p.Linux.release())
+	fmt.Fprintf(buf, "pkgdesc = %s\n", p.summary())
+	if p.SiteURL != "" {
+		fmt.Fprintf(buf, "url = %s\n", p.SiteURL)
+	}
+	fmt.Fprintf(buf, "builddate = %d\n", builddate.Unix())
+	fmt.Fprintf(buf, "packager = %s\n", p.maintainer())
+	fmt.Fprintf(buf, "size = %d\n", size)
+	fmt.Fprintf(buf, "arch = %s\n", arch)
+	fmt.Fprintf(buf, "license = %s\n", p.license())
+	return buf.String()
+}
+
+// pacmanMtree generates a gzip-compressed mtree specification of files, in
+// the form makepkg produces with bsdtar
+func pacmanMtree(files []archiveFile, modTime time.Time) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	fmt.Fprintf(gw, "#mtree\n")
+	fmt.Fprintf(gw, "/set type=file uid=0 gid=0 mode=644\n")
+	for _, f := range files {
+		name := "./" + strings.TrimSuffix(f.Name, "/")
+		if f.Dir {
+			fmt.Fprintf(gw, "%s time=%d.0 mode=%o type=dir\n", name, modTime.Unix(), f.Mode)
+			continue
+		}
+		fmt.Fprintf(gw, "%s time=%d.0", name, modTime.Unix())
+		if f.Mode != 0644 {
+			fmt.Fprintf(gw, " mode=%o", f.Mode)
+		}
+		fmt.Fprintf(gw, " size=%d md5digest=%x sha256digest=%x\n", len(f.Body), md5.Sum(f.Body), sha256.Sum256(f.Body))
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pacmanPKGBUILD generates a PKGBUILD that packages the binary and license
+// the same way linuxPacman does, for use with makepkg
+func (p Package) pacmanPKGBUILD(arch string, bin, license []byte) string {
+	binDir := filepath.ToSlash(filepath.Join(p.Linux.prefix(), "bin"))
+	sources := []string{p.BinName}
+	sums := []string{fmt.Sprintf("%x", sha256.Sum256(bin))}
+	if license != nil {
+		sources = append(sources, "LICENSE")
+		sums = append(sums, fmt.Sprintf("%x", sha256.Sum256(license)))
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# Maintainer: %s\n", p.maintainer())
+	fmt.Fprintf(buf, "pkgname=%s\n", p.BinName)
+	fmt.Fprintf(buf, "pkgver=%s\n", p.pacmanVersion())
+	fmt.Fprintf(buf, "pkgrel=%s\n", p.Linux.release())
+	fmt.Fprintf(buf, "pkgdesc=%s\n", shellQuote(p.summary()))
+	fmt.Fprintf(buf, "arch=('%s')\n", arch)
+	if p.SiteURL != "" {
+		fmt.Fprintf(buf, "url=%s\n", shellQuote(p.SiteURL))
+	}
+	fmt.Fprintf(buf, "license=(%s)\n", shellQuote(p.license()))
+	fmt.Fprintf(buf, "options=('!strip')\n")
+	fmt.Fprintf(buf, "source=(%s)\n", shellQuoteAll(sources))
+	fmt.Fprintf(buf, "sha256sums=(%s)\n", shellQuoteAll(sums))
+	fmt.Fprintf(buf, "\npackage() {\n")
+	fmt.Fprintf(buf, "  install -Dm755 \"$srcdir/%s\" \"$pkgdir%s/%s\"\n", p.BinName, binDir, p.BinName)
+	if license != nil {
+		fmt.Fprintf(buf, "  install -Dm644 \"$srcdir/LICENSE\" \"$pkgdir/usr/share/licenses/$pkgname/LICENSE\"\n")
+	}
+	fmt.Fprintf(buf, "}\n")
+	return buf.String()
+}
+
+// shellQuote wraps s in single quotes for use in a shell script
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellQuoteAll single-quotes each of strs, joined with spaces
+func shellQuoteAll(strs []string) string {
+	quoted := make([]string, len(strs))
+	for i, s := range strs {
+		quoted[i] = shellQuote(s)
+	}
+	return strings.Join(quoted, " ")
+}
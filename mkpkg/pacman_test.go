@@ -0,0 +1,126 @@
+package mkpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestLinuxPacman(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path, err := p.linuxPacman()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(path); got != "qri-0.5.0-1-x86_64.pkg.tar.zst" {
+		t.Errorf("package name mismatch: %s", got)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	entries := readTar(t, zr)
+
+	want := ".MTREE,.PKGINFO,usr/,usr/bin/,usr/bin/qri,usr/share/,usr/share/licenses/,usr/share/licenses/qri/,usr/share/licenses/qri/LICENSE"
+	if got := strings.Join(tarNames(entries), ","); got != want {
+		t.Errorf("entries mismatch.\ngot:  %s\nwant: %s", got, want)
+	}
+
+	pkginfo := string(tarFile(t, entries, ".PKGINFO").Body)
+	for _, line := range []string{
+		"pkgname = qri\n",
+		"pkgver = 0.5.0-1\n",
+		"arch = x86_64\n",
+		"license = GPL-3.0\n",
+		"packager = Qri, Inc. <sparkle_pony@qri.io>\n",
+		fmt.Sprintf("size = %d\n", len(testBin)+len("GNU GENERAL PUBLIC LICENSE\n")),
+	} {
+		if !strings.Contains(pkginfo, line) {
+			t.Errorf(".PKGINFO missing %q:\n%s", line, pkginfo)
+		}
+	}
+
+	// .MTREE describes every entry but itself
+	gr, err := gzip.NewReader(bytes.NewReader(tarFile(t, entries, ".MTREE").Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtree, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(mtree)), "\n")[2:] {
+		fields := strings.SplitN(line, " ", 2)
+		specs[fields[0]] = fields[1]
+	}
+	if len(specs) != len(entries)-1 {
+		t.Errorf("expected %d .MTREE entries, got %d:\n%s", len(entries)-1, len(specs), mtree)
+	}
+	for _, e := range entries[1:] {
+		spec, ok := specs["./"+strings.TrimSuffix(e.Header.Name, "/")]
+		if !ok {
+			t.Errorf(".MTREE missing %s", e.Header.Name)
+			continue
+		}
+		if e.Header.Typeflag == '5' {
+			if !strings.Contains(spec, "type=dir") {
+				t.Errorf("%s: expected directory spec, got: %s", e.Header.Name, spec)
+			}
+			continue
+		}
+		sum := fmt.Sprintf("size=%d md5digest=", len(e.Body))
+		if !strings.Contains(spec, sum) || !strings.HasSuffix(spec, fmt.Sprintf("sha256digest=%x", sha256.Sum256(e.Body))) {
+			t.Errorf("%s: spec doesn't match contents: %s", e.Header.Name, spec)
+		}
+	}
+	if spec := specs["./usr/bin/qri"]; !strings.Contains(spec, "mode=755") {
+		t.Errorf("binary spec missing mode: %s", spec)
+	}
+
+	pkgbuild, err := ioutil.ReadFile(filepath.Join(p.OutDir, "PKGBUILD-x86_64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"pkgname=qri\n",
+		"arch=('x86_64')\n",
+		"source=('qri' 'LICENSE')\n",
+		fmt.Sprintf("sha256sums=('%x'", sha256.Sum256([]byte(testBin))),
+	} {
+		if !strings.Contains(string(pkgbuild), line) {
+			t.Errorf("PKGBUILD missing %q:\n%s", line, pkgbuild)
+		}
+	}
+	if _, err := exec.LookPath("bash"); err == nil {
+		if out, err := exec.Command("bash", "-n", filepath.Join(p.OutDir, "PKGBUILD-x86_64")).CombinedOutput(); err != nil {
+			t.Errorf("PKGBUILD has syntax errors: %s\n%s", err, out)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("it's"); got != `'it'\''s'` {
+		t.Errorf("quote mismatch: %s", got)
+	}
+	if got := shellQuoteAll([]string{"a", "b c"}); got != `'a' 'b c'` {
+		t.Errorf("quote all mismatch: %s", got)
+	}
+}
@@ -0,0 +1,478 @@
+package mkpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rpmArchs maps GOARCH values to rpm architecture names
+var rpmArchs = map[string]string{
+	"386":      "i686",
+	"amd64":    "x86_64",
+	"arm":      "armv7hl",
+	"arm64":    "aarch64",
+	"ppc64le":  "ppc64le",
+	"s390x":    "s390x",
+	"mips64le": "mips64el",
+}
+
+// rpm header tag data types
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// rpm header region tags
+const (
+	rpmTagHeaderSignatures = 62
+	rpmTagHeaderImmutable  = 63
+)
+
+// rpm signature header tags
+const (
+	rpmSigTagSHA1        = 269
+	rpmSigTagSHA256      = 273
+	rpmSigTagSize        = 1000
+	rpmSigTagMD5         = 1004
+	rpmSigTagPayloadSize = 1007
+)
+
+// rpm header tags
+const (
+	rpmTagName              = 1000
+	rpmTagVersion           = 1001
+	rpmTagRelease           = 1002
+	rpmTagSummary           = 1004
+	rpmTagDescription       = 1005
+	rpmTagBuildTime         = 1006
+	rpmTagBuildHost         = 1007
+	rpmTagSize              = 1009
+	rpmTagLicense           = 1014
+	rpmTagPackager          = 1015
+	rpmTagGroup             = 1016
+	rpmTagURL               = 1020
+	rpmTagOS                = 1021
+	rpmTagArch              = 1022
+	rpmTagFileSizes         = 1028
+	rpmTagFileModes         = 1030
+	rpmTagFileRdevs         = 1033
+	rpmTagFileMtimes        = 1034
+	rpmTagFileDigests       = 1035
+	rpmTagFileLinkTos       = 1036
+	rpmTagFileFlags         = 1037
+	rpmTagFileUsername      = 1039
+	rpmTagFileGroupname     = 1040
+	rpmTagSourceRPM         = 1044
+	rpmTagProvideName       = 1047
+	rpmTagRequireFlags      = 1048
+	rpmTagRequireName       = 1049
+	rpmTagRequireVersion    = 1050
+	rpmTagRPMVersion        = 1064
+	rpmTagFileDevices       = 1095
+	rpmTagFileInodes        = 1096
+	rpmTagFileLangs         = 1097
+	rpmTagProvideFlags      = 1112
+	rpmTagProvideVersion    = 1113
+	rpmTagDirIndexes        = 1116
+	rpmTagBasenames         = 1117
+	rpmTagDirnames          = 1118
+	rpmTagPayloadFormat     = 1124
+	rpmTagPayloadCompressor = 1125
+	rpmTagPayloadFlags      = 1126
+	rpmTagFileDigestAlgo    = 5011
+)
+
+// rpm dependency sense flags
+const (
+	rpmSenseLess   = 1 << 1
+	rpmSenseEqual  = 1 << 3
+	rpmSenseRPMLib = 1 << 24
+)
+
+func (p Package) linuxRPM() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := rpmArchs[p.Linux.arch()]
+	if !ok {
+		return "", fmt.Errorf("unsupported rpm architecture: %s", p.Linux.arch())
+	}
+
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	binPath := filepath.ToSlash(filepath.Join(p.Linux.prefix(), "bin", p.BinName))
+	var files []rpmFile
+	for _, dir := range rpmDirs(binPath) {
+		files = append(files, rpmFile{Path: dir, Mode: 040755, ModTime: now})
+	}
+	files = append(files, rpmFile{Path: binPath, Mode: 0100755, Body: bin, ModTime: now})
+
+	payload, payloadSize, err := rpmPayload(files)
+	if err != nil {
+		return "", err
+	}
+
+	header := p.rpmHeader(arch, files, now).bytes(rpmTagHeaderImmutable)
+	sig := rpmSignature(header, payload, payloadSize).bytes(rpmTagHeaderSignatures)
+	// the signature header is padded to an 8 byte boundary
+	if pad := len(sig) % 8; pad != 0 {
+		sig = append(sig, make([]byte, 8-pad)...)
+	}
+
+	name := fmt.Sprintf("%s-%s-%s.%s.rpm", p.BinName, p.rpmVersion(), p.Linux.release(), arch)
+	f, err := os.Create(filepath.Join(outDir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, b := range [][]byte{p.rpmLead(), sig, header, payload} {
+		if _, err := f.Write(b); err != nil {
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// rpmVersion returns the package version in a form rpm accepts. rpm versions
+// cannot contain dashes, and a tilde sorts pre-releases before releases
+func (p Package) rpmVersion() string {
+	return strings.Replace(p.pkgVersion(), "-", "~", -1)
+}
+
+// rpmLead creates the legacy 96 byte lead that opens every rpm file
+func (p Package) rpmLead() []byte {
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	// package type 0 is binary, archnum & osnum are ignored by modern rpm
+	binary.BigEndian.PutUint16(lead[6:], 0)
+	binary.BigEndian.PutUint16(lead[8:], 1)
+	copy(lead[10:75], fmt.Sprintf("%s-%s-%s", p.BinName, p.rpmVersion(), p.Linux.release()))
+	binary.BigEndian.PutUint16(lead[76:], 1)
+	// signature type 5 is a header-style signature
+	binary.BigEndian.PutUint16(lead[78:], 5)
+	return lead
+}
+
+// rpmSystemDirs are directories owned by the filesystem package, which
+// packages must not claim
+var rpmSystemDirs = map[string]bool{
+	"/": true, "/bin": true, "/etc": true, "/opt": true, "/usr": true, "/usr/bin": true,
+	"/usr/local": true, "/usr/local/bin": true, "/usr/share": true,
+}
+
+// rpmDirs lists the directories the package owns for a file at path: every
+// parent that isn't a system directory, parents first
+func rpmDirs(file string) []string {
+	var dirs []string
+	for dir := path.Dir(file); !rpmSystemDirs[dir]; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
+
+// rpmFile is a single file or directory to include in an rpm payload
+type rpmFile struct {
+	Path    string
+	Mode    uint16
+	Body    []byte
+	ModTime time.Time
+}
+
+// rpmHeader builds the main rpm header describing the package and its files
+func (p Package) rpmHeader(arch string, files []rpmFile, buildTime time.Time) *rpmHeader {
+	h := &rpmHeader{}
+	h.addString(rpmTagName, p.BinName)
+	h.addString(rpmTagVersion, p.rpmVersion())
+	h.addString(rpmTagRelease, p.Linux.release())
+	h.addI18NString(rpmTagSummary, p.Name)
+	h.addI18NString(rpmTagDescription, strings.TrimSpace(p.Description))
+	h.addInt32(rpmTagBuildTime, uint32(buildTime.Unix()))
+	h.addString(rpmTagBuildHost, "localhost")
+	h.addString(rpmTagLicense, p.license())
+	h.addString(rpmTagPackager, p.maintainer())
+	h.addI18NString(rpmTagGroup, p.Linux.group())
+	if p.SiteURL != "" {
+		h.addString(rpmTagURL, p.SiteURL)
+	}
+	h.addString(rpmTagOS, "linux")
+	h.addString(rpmTagArch, arch)
+	h.addString(rpmTagSourceRPM, fmt.Sprintf("%s-%s-%s.src.rpm", p.BinName, p.rpmVersion(), p.Linux.release()))
+	h.addString(rpmTagRPMVersion, "4.14.0")
+	h.addString(rpmTagPayloadFormat, "cpio")
+	h.addString(rpmTagPayloadCompressor, "gzip")
+	h.addString(rpmTagPayloadFlags, "9")
+
+	// provide the package name, and the reverse-domain identifier so other
+	// packages can depend on the project regardless of binary name
+	provides, provideVersions, provideFlags := []string{p.BinName}, []string{p.rpmVersion() + "-" + p.Linux.release()}, []uint32{rpmSenseEqual}
+	if p.Identifier != "" {
+		provides = append(provides, p.Identifier)
+		provideVersions = append(provideVersions, p.rpmVersion()+"-"+p.Linux.release())
+		provideFlags = append(provideFlags, rpmSenseEqual)
+	}
+	h.addStringArray(rpmTagProvideName, provides...)
+	h.addInt32(rpmTagProvideFlags, provideFlags...)
+	h.addStringArray(rpmTagProvideVersion, provideVersions...)
+
+	// rpmlib features this package relies on
+	rpmlibFlags := uint32(rpmSenseLess | rpmSenseEqual | rpmSenseRPMLib)
+	h.addStringArray(rpmTagRequireName, "rpmlib(CompressedFileNames)", "rpmlib(FileDigests)", "rpmlib(PayloadFilesHavePrefix)")
+	h.addInt32(rpmTagRequireFlags, rpmlibFlags, rpmlibFlags, rpmlibFlags)
+	h.addStringArray(rpmTagRequireVersion, "3.0.4-1", "4.6.0-1", "4.0-1")
+
+	var (
+		size                                uint32
+		sizes, mtimes, flags, inodes, devs  []uint32
+		dirIndexes                          []uint32
+		modes, rdevs                        []uint16
+		digests, links, users, groups, lang []string
+		basenames, dirnames                 []string
+	)
+	dirIdx := map[string]uint32{}
+	for i, f := range files {
+		size += uint32(len(f.Body))
+		sizes = append(sizes, uint32(len(f.Body)))
+		mtimes = append(mtimes, uint32(f.ModTime.Unix()))
+		flags = append(flags, 0)
+		inodes = append(inodes, uint32(i+1))
+		devs = append(devs, 1)
+		modes = append(modes, f.Mode)
+		rdevs = append(rdevs, 0)
+		// directories have no digest
+		digest := ""
+		if f.Mode&040000 == 0 {
+			sum := sha256.Sum256(f.Body)
+			digest = hex.EncodeToString(sum[:])
+		}
+		digests = append(digests, digest)
+		links = append(links, "")
+		users = append(users, "root")
+		groups = append(groups, "root")
+		lang = append(lang, "")
+
+		dir := path.Dir(f.Path) + "/"
+		idx, ok := dirIdx[dir]
+		if !ok {
+			idx = uint32(len(dirnames))
+			dirIdx[dir] = idx
+			dirnames = append(dirnames, dir)
+		}
+		dirIndexes = append(dirIndexes, idx)
+		basenames = append(basenames, path.Base(f.Path))
+	}
+
+	h.addInt32(rpmTagSize, size)
+	h.addInt32(rpmTagFileSizes, sizes...)
+	h.addInt16(rpmTagFileModes, modes...)
+	h.addInt16(rpmTagFileRdevs, rdevs...)
+	h.addInt32(rpmTagFileMtimes, mtimes...)
+	h.addStringArray(rpmTagFileDigests, digests...)
+	h.addStringArray(rpmTagFileLinkTos, links...)
+	h.addInt32(rpmTagFileFlags, flags...)
+	h.addStringArray(rpmTagFileUsername, users...)
+	h.addStringArray(rpmTagFileGroupname, groups...)
+	h.addInt32(rpmTagFileDevices, devs...)
+	h.addInt32(rpmTagFileInodes, inodes...)
+	h.addStringArray(rpmTagFileLangs, lang...)
+	h.addInt32(rpmTagDirIndexes, dirIndexes...)
+	h.addStringArray(rpmTagBasenames, basenames...)
+	h.addStringArray(rpmTagDirnames, dirnames...)
+	// digest algorithm 8 is sha256
+	h.addInt32(rpmTagFileDigestAlgo, 8)
+	return h
+}
+
+// rpmSignature builds the signature header, which holds digests of the
+// main header and payload
+func rpmSignature(header, payload []byte, payloadSize int) *rpmHeader {
+	sha1sum := sha1.Sum(header)
+	sha256sum := sha256.Sum256(header)
+	md5sum := md5.New()
+	md5sum.Write(header)
+	md5sum.Write(payload)
+
+	h := &rpmHeader{}
+	h.addString(rpmSigTagSHA1, hex.EncodeToString(sha1sum[:]))
+	h.addString(rpmSigTagSHA256, hex.EncodeToString(sha256sum[:]))
+	h.addInt32(rpmSigTagSize, uint32(len(header)+len(payload)))
+	h.addBin(rpmSigTagMD5, md5sum.Sum(nil))
+	h.addInt32(rpmSigTagPayloadSize, uint32(payloadSize))
+	return h
+}
+
+// rpmPayload creates the gzipped cpio archive of package files, returning
+// compressed bytes and the uncompressed size
+func rpmPayload(files []rpmFile) ([]byte, int, error) {
+	cpio := &bytes.Buffer{}
+	for i, f := range files {
+		if err := writeCpioEntry(cpio, uint32(i+1), "."+f.Path, uint32(f.Mode), f.ModTime, f.Body); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := writeCpioTrailer(cpio); err != nil {
+		return nil, 0, err
+	}
+
+	buf := &bytes.Buffer{}
+	gw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := gw.Write(cpio.Bytes()); err != nil {
+		return nil, 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), cpio.Len(), nil
+}
+
+// writeCpioEntry writes a single "newc" format cpio entry to w
+func writeCpioEntry(w io.Writer, ino uint32, name string, mode uint32, modTime time.Time, body []byte) error {
+	nlink := 1
+	if mode&040000 != 0 {
+		nlink = 2
+	}
+	hdr := fmt.Sprintf("070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		ino, mode, 0, 0, nlink, modTime.Unix(), len(body), 0, 0, 0, 0, len(name)+1, 0)
+	if _, err := io.WriteString(w, hdr+name+"\x00"+cpioPad(len(hdr)+len(name)+1)); err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, cpioPad(len(body)))
+	return err
+}
+
+// writeCpioTrailer writes the entry that terminates a cpio archive
+func writeCpioTrailer(w io.Writer) error {
+	return writeCpioEntry(w, 0, "TRAILER!!!", 0, time.Unix(0, 0), nil)
+}
+
+// cpioPad returns the NUL padding needed to align n bytes to 4 bytes
+func cpioPad(n int) string {
+	return strings.Repeat("\x00", (4-n%4)%4)
+}
+
+// rpmHeader accumulates tagged entries for an rpm header structure
+type rpmHeader struct {
+	entries []rpmEntry
+}
+
+type rpmEntry struct {
+	tag, typ, count uint32
+	data            []byte
+}
+
+func (h *rpmHeader) add(tag, typ, count uint32, data []byte) {
+	h.entries = append(h.entries, rpmEntry{tag: tag, typ: typ, count: count, data: data})
+}
+
+func (h *rpmHeader) addString(tag uint32, s string) {
+	h.add(tag, rpmTypeString, 1, append([]byte(s), 0))
+}
+
+func (h *rpmHeader) addI18NString(tag uint32, s string) {
+	h.add(tag, rpmTypeI18NString, 1, append([]byte(s), 0))
+}
+
+func (h *rpmHeader) addStringArray(tag uint32, strs ...string) {
+	buf := &bytes.Buffer{}
+	for _, s := range strs {
+		buf.WriteString(s)
+		buf.WriteByte(0)
+	}
+	h.add(tag, rpmTypeStringArray, uint32(len(strs)), buf.Bytes())
+}
+
+func (h *rpmHeader) addBin(tag uint32, b []byte) {
+	h.add(tag, rpmTypeBin, uint32(len(b)), b)
+}
+
+func (h *rpmHeader) addInt16(tag uint32, vals ...uint16) {
+	data := make([]byte, 2*len(vals))
+	for i, v := range vals {
+		binary.BigEndian.PutUint16(data[2*i:], v)
+	}
+	h.add(tag, rpmTypeInt16, uint32(len(vals)), data)
+}
+
+func (h *rpmHeader) addInt32(tag uint32, vals ...uint32) {
+	data := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.BigEndian.PutUint32(data[4*i:], v)
+	}
+	h.add(tag, rpmTypeInt32, uint32(len(vals)), data)
+}
+
+// bytes serializes the header, prefixed with an immutable region entry
+// identified by regionTag
+func (h *rpmHeader) bytes(regionTag uint32) []byte {
+	entries := append([]rpmEntry{}, h.entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	nindex := len(entries) + 1
+	index := &bytes.Buffer{}
+	store := &bytes.Buffer{}
+	writeIndex := func(tag, typ, offset, count uint32) {
+		binary.Write(index, binary.BigEndian, []uint32{tag, typ, offset, count})
+	}
+
+	// the region entry comes first in the index, but points at a trailer
+	// stored at the end of the data store
+	for _, e := range entries {
+		// align numeric types to their natural size
+		align := 1
+		switch e.typ {
+		case rpmTypeInt16:
+			align = 2
+		case rpmTypeInt32:
+			align = 4
+		}
+		for store.Len()%align != 0 {
+			store.WriteByte(0)
+		}
+		writeIndex(e.tag, e.typ, uint32(store.Len()), e.count)
+		store.Write(e.data)
+	}
+
+	trailerOffset := uint32(store.Len())
+	binary.Write(store, binary.BigEndian, []uint32{regionTag, rpmTypeBin, uint32(-int32(nindex * 16)), 16})
+
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	binary.Write(buf, binary.BigEndian, []uint32{uint32(nindex), uint32(store.Len())})
+	binary.Write(buf, binary.BigEndian, []uint32{regionTag, rpmTypeBin, trailerOffset, 16})
+	buf.Write(index.Bytes())
+	buf.Write(store.Bytes())
+	return buf.Bytes()
+}
@@ -0,0 +1,238 @@
+package mkpkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parsedRPMHeader is an rpm header structure read back from a package
+type parsedRPMHeader struct {
+	// raw bytes of the header, including magic, index & data store
+	raw     []byte
+	entries map[uint32]parsedRPMEntry
+}
+
+type parsedRPMEntry struct {
+	typ, offset, count uint32
+	data               []byte
+}
+
+// parseRPMHeader reads a header structure from the start of data, checking
+// every index entry points within the data store
+func parseRPMHeader(t *testing.T, data []byte) parsedRPMHeader {
+	t.Helper()
+	if len(data) < 16 || !bytes.Equal(data[:4], []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		t.Fatalf("missing header magic")
+	}
+	nindex := binary.BigEndian.Uint32(data[8:])
+	hsize := binary.BigEndian.Uint32(data[12:])
+	end := 16 + int(nindex)*16 + int(hsize)
+	if end > len(data) {
+		t.Fatalf("header with %d entries & %d byte store overruns file", nindex, hsize)
+	}
+	store := data[16+int(nindex)*16 : end]
+
+	h := parsedRPMHeader{raw: data[:end], entries: map[uint32]parsedRPMEntry{}}
+	for i := 0; i < int(nindex); i++ {
+		idx := data[16+i*16:]
+		tag := binary.BigEndian.Uint32(idx)
+		e := parsedRPMEntry{
+			typ:    binary.BigEndian.Uint32(idx[4:]),
+			offset: binary.BigEndian.Uint32(idx[8:]),
+			count:  binary.BigEndian.Uint32(idx[12:]),
+		}
+		if e.offset >= hsize {
+			t.Fatalf("tag %d offset %d is outside the %d byte data store", tag, e.offset, hsize)
+		}
+		e.data = store[e.offset:]
+		h.entries[tag] = e
+	}
+	return h
+}
+
+func (h parsedRPMHeader) strings(t *testing.T, tag uint32) []string {
+	t.Helper()
+	e, ok := h.entries[tag]
+	if !ok {
+		t.Fatalf("header missing tag %d", tag)
+	}
+	return strings.Split(string(e.data), "\x00")[:e.count]
+}
+
+func (h parsedRPMHeader) string(t *testing.T, tag uint32) string {
+	return h.strings(t, tag)[0]
+}
+
+func (h parsedRPMHeader) int32s(t *testing.T, tag uint32) []uint32 {
+	t.Helper()
+	e, ok := h.entries[tag]
+	if !ok {
+		t.Fatalf("header missing tag %d", tag)
+	}
+	if e.offset%4 != 0 {
+		t.Errorf("tag %d int32 data isn't aligned: offset %d", tag, e.offset)
+	}
+	vals := make([]uint32, e.count)
+	for i := range vals {
+		vals[i] = binary.BigEndian.Uint32(e.data[4*i:])
+	}
+	return vals
+}
+
+// readCpio lists the names & bodies of entries in a newc cpio archive
+func readCpio(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	for {
+		if len(data) < 110 || string(data[:6]) != "070701" {
+			t.Fatalf("bad cpio header")
+		}
+		field := func(i int) int {
+			v, err := strconv.ParseUint(string(data[6+i*8:14+i*8]), 16, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return int(v)
+		}
+		size, nameSize := field(6), field(11)
+		name := string(data[110 : 110+nameSize-1])
+		start := 110 + nameSize
+		start += (4 - start%4) % 4
+		if name == "TRAILER!!!" {
+			return files
+		}
+		files[name] = data[start : start+size]
+		next := start + size
+		data = data[next+(4-next%4)%4:]
+	}
+}
+
+func TestLinuxRPM(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Linux.Prefix = "/opt/qri"
+
+	path, err := p.linuxRPM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lead
+	if !bytes.Equal(data[:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		t.Fatalf("missing lead magic")
+	}
+	if name := string(bytes.TrimRight(data[10:76], "\x00")); name != "qri-0.5.0-1" {
+		t.Errorf("lead name mismatch: %q", name)
+	}
+	if sigType := binary.BigEndian.Uint16(data[78:]); sigType != 5 {
+		t.Errorf("lead signature type mismatch: %d", sigType)
+	}
+
+	// signature header, padded to 8 bytes
+	sig := parseRPMHeader(t, data[96:])
+	headerStart := 96 + len(sig.raw)
+	headerStart += (8 - headerStart%8) % 8
+	header := parseRPMHeader(t, data[headerStart:])
+	payload := data[headerStart+len(header.raw):]
+
+	if got := len(header.entries); got < 40 {
+		t.Errorf("expected at least 40 header tags, got %d", got)
+	}
+	region := header.entries[rpmTagHeaderImmutable]
+	if region.typ != rpmTypeBin || region.count != 16 {
+		t.Errorf("bad immutable region entry: %#v", region)
+	}
+
+	headerSum := sha256.Sum256(header.raw)
+	if got := sig.string(t, rpmSigTagSHA256); got != hex.EncodeToString(headerSum[:]) {
+		t.Errorf("header sha256 mismatch. got: %s", got)
+	}
+	md5sum := md5.New()
+	md5sum.Write(header.raw)
+	md5sum.Write(payload)
+	if got := sig.entries[rpmSigTagMD5].data[:16]; !bytes.Equal(got, md5sum.Sum(nil)) {
+		t.Errorf("header+payload md5 mismatch")
+	}
+	if got := sig.int32s(t, rpmSigTagSize)[0]; int(got) != len(header.raw)+len(payload) {
+		t.Errorf("signature size mismatch. got: %d, want: %d", got, len(header.raw)+len(payload))
+	}
+
+	for tag, want := range map[uint32]string{
+		rpmTagName:     "qri",
+		rpmTagVersion:  "0.5.0",
+		rpmTagRelease:  "1",
+		rpmTagArch:     "x86_64",
+		rpmTagLicense:  "GPL-3.0",
+		rpmTagPackager: "Qri, Inc. <sparkle_pony@qri.io>",
+	} {
+		if got := header.string(t, tag); got != want {
+			t.Errorf("tag %d mismatch. got: %q, want: %q", tag, got, want)
+		}
+	}
+	if got := strings.Join(header.strings(t, rpmTagProvideName), ","); got != "qri,io.qri.cli" {
+		t.Errorf("provides mismatch: %s", got)
+	}
+	if got := strings.Join(header.strings(t, rpmTagBasenames), ","); got != "qri,bin,qri" {
+		t.Errorf("basenames mismatch: %s", got)
+	}
+	if got := strings.Join(header.strings(t, rpmTagDirnames), ","); got != "/opt/,/opt/qri/,/opt/qri/bin/" {
+		t.Errorf("dirnames mismatch: %s", got)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpio, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sig.int32s(t, rpmSigTagPayloadSize)[0]; int(got) != len(cpio) {
+		t.Errorf("payload size mismatch. got: %d, want: %d", got, len(cpio))
+	}
+	files := readCpio(t, cpio)
+	if string(files["./opt/qri/bin/qri"]) != testBin {
+		t.Errorf("payload binary mismatch: %q", files["./opt/qri/bin/qri"])
+	}
+	if _, ok := files["./opt/qri"]; !ok {
+		t.Errorf("payload is missing the /opt/qri directory")
+	}
+
+	if _, err := exec.LookPath("rpm"); err != nil {
+		t.Log("rpm not found, skipping rpm checks")
+		return
+	}
+	for _, args := range [][]string{{"-qpi", path}, {"-K", "--nosignature", path}} {
+		if out, err := exec.Command("rpm", args...).CombinedOutput(); err != nil {
+			t.Errorf("rpm %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
+
+func TestRPMDirs(t *testing.T) {
+	cases := []struct {
+		file, want string
+	}{
+		{"/usr/bin/qri", ""},
+		{"/usr/local/bin/qri", ""},
+		{"/opt/qri/bin/qri", "/opt/qri,/opt/qri/bin"},
+	}
+	for _, c := range cases {
+		if got := strings.Join(rpmDirs(c.file), ","); got != c.want {
+			t.Errorf("%s: dirs mismatch. got: %q, want: %q", c.file, got, c.want)
+		}
+	}
+}
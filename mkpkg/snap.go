@@ -0,0 +1,226 @@
+package mkpkg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/qri-io/mkpkg/mkpkg/squashfs"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SnapConfig encapsulates configuration details for creating a snap. Snaps
+// install the binary & icon from the Linux configuration
+type SnapConfig struct {
+	// snap name. Default is BinName
+	Name string
+	// one of: strict, classic, devmode. Default is strict
+	Confinement string
+	// one of: stable, devel. Default is stable
+	Grade string
+	// base snap providing the runtime environment. Default is core22
+	Base string
+	// interfaces the binary connects to. Default is [home, network]
+	Plugs []string
+}
+
+// name returns the configured snap name, defaulting to the binary name
+func (c SnapConfig) name(p Package) string {
+	if c.Name == "" {
+		return strings.ToLower(p.BinName)
+	}
+	return c.Name
+}
+
+// confinement returns the configured confinement, defaulting to strict
+func (c SnapConfig) confinement() string {
+	if c.Confinement == "" {
+		return "strict"
+	}
+	return c.Confinement
+}
+
+// grade returns the configured grade, defaulting to stable
+func (c SnapConfig) grade() string {
+	if c.Grade == "" {
+		return "stable"
+	}
+	return c.Grade
+}
+
+// base returns the configured base snap, defaulting to core22
+func (c SnapConfig) base() string {
+	if c.Base == "" {
+		return "core22"
+	}
+	return c.Base
+}
+
+// plugs returns the configured plugs, defaulting to home & network
+func (c SnapConfig) plugs() []string {
+	if c.Plugs == nil {
+		return []string{"home", "network"}
+	}
+	return c.Plugs
+}
+
+// snapYAML is the shared subset of snapcraft.yaml & meta/snap.yaml
+type snapYAML struct {
+	Name          string              `yaml:"name"`
+	Base          string              `yaml:"base"`
+	Version       string              `yaml:"version"`
+	Summary       string              `yaml:"summary"`
+	Description   string              `yaml:"description"`
+	Grade         string              `yaml:"grade"`
+	Confinement   string              `yaml:"confinement"`
+	Architectures []string            `yaml:"architectures,omitempty"`
+	Parts         map[string]snapPart `yaml:"parts,omitempty"`
+	Apps          map[string]snapApp  `yaml:"apps"`
+}
+
+type snapPart struct {
+	Plugin   string            `yaml:"plugin"`
+	Source   string            `yaml:"source"`
+	Stage    []string          `yaml:"stage"`
+	Organize map[string]string `yaml:"organize"`
+}
+
+type snapApp struct {
+	Command string   `yaml:"command"`
+	Plugs   []string `yaml:"plugs,omitempty"`
+}
+
+func (p Package) linuxSnap() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := debArchs[p.Linux.arch()]
+	if !ok {
+		return "", fmt.Errorf("unsupported snap architecture: %s", p.Linux.arch())
+	}
+
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	name := p.Snap.name(p)
+	meta, err := p.snapYAML(arch, false)
+	if err != nil {
+		return "", err
+	}
+	snapYaml, err := yaml.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	snapcraft, err := p.snapYAML(arch, true)
+	if err != nil {
+		return "", err
+	}
+	snapcraftYaml, err := yaml.Marshal(snapcraft)
+	if err != nil {
+		return "", err
+	}
+
+	// the prime directory is the filesystem of the installed snap
+	prime := []archiveFile{
+		{Name: "meta/snap.yaml", Mode: 0644, Body: snapYaml},
+		{Name: path.Join("bin", p.BinName), Mode: 0755, Body: bin},
+	}
+	if p.Linux.IconPath != "" {
+		icon, err := ioutil.ReadFile(p.Linux.IconPath)
+		if err != nil {
+			return "", err
+		}
+		iconName := "icon" + strings.ToLower(filepath.Ext(p.Linux.IconPath))
+		prime = append(prime,
+			archiveFile{Name: path.Join("meta/gui", iconName), Mode: 0644, Body: icon},
+			archiveFile{Name: path.Join("meta/gui", name+".desktop"), Mode: 0644, Body: []byte(p.desktopEntry(name, "${SNAP}/meta/gui/"+iconName))},
+		)
+	}
+
+	// the kernel can mount gzip images everywhere snapd runs
+	snap := &bytes.Buffer{}
+	sw, err := squashfs.NewWriter(snap, squashfs.WriterOptions{Compression: squashfs.Gzip})
+	if err != nil {
+		return "", err
+	}
+	for _, f := range prime {
+		if err := sw.WriteFile(squashfs.FileHeader{Name: f.Name, Mode: os.FileMode(f.Mode)}, f.Body); err != nil {
+			return "", err
+		}
+	}
+	if err := sw.Close(); err != nil {
+		return "", err
+	}
+
+	// snapcraft projects are per-architecture, so snaps for different
+	// architectures can be built at once. snapcraft looks for
+	// snap/snapcraft.yaml in the project directory
+	project := filepath.Join(outDir, "snap-"+p.Linux.arch(), "snap")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(project, "snapcraft.yaml"), snapcraftYaml, 0644); err != nil {
+		return "", err
+	}
+	out := filepath.Join(outDir, fmt.Sprintf("%s_%s_%s.snap", name, p.pkgVersion(), arch))
+	if err := ioutil.WriteFile(out, snap.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// snapYAML describes the snap. snapcraft reads parts from snapcraft.yaml to
+// assemble the prime directory, snapd reads the prime directory's
+// meta/snap.yaml
+func (p Package) snapYAML(arch string, snapcraft bool) (snapYAML, error) {
+	summary := p.summary()
+	if len(summary) > 78 {
+		summary = strings.TrimSpace(summary[:75]) + "..."
+	}
+
+	s := snapYAML{
+		Name:        p.Snap.name(p),
+		Base:        p.Snap.base(),
+		Version:     p.pkgVersion(),
+		Summary:     summary,
+		Description: strings.TrimSpace(p.Description),
+		Grade:       p.Snap.grade(),
+		Confinement: p.Snap.confinement(),
+		Apps: map[string]snapApp{
+			p.Snap.name(p): {Command: path.Join("bin", p.BinName), Plugs: p.Snap.plugs()},
+		},
+	}
+	if s.Description == "" {
+		s.Description = p.Name
+	}
+
+	if snapcraft {
+		// snapcraft resolves a relative source against the project directory,
+		// not the directory mkpkg was run from
+		source, err := filepath.Abs(filepath.Dir(p.Linux.BinPath))
+		if err != nil {
+			return s, err
+		}
+		// stage filters paths after they've been organized
+		bin := path.Join("bin", p.BinName)
+		s.Parts = map[string]snapPart{
+			p.BinName: {
+				Plugin:   "dump",
+				Source:   filepath.ToSlash(source),
+				Stage:    []string{bin},
+				Organize: map[string]string{filepath.Base(p.Linux.BinPath): bin},
+			},
+		}
+	} else {
+		s.Architectures = []string{arch}
+	}
+	return s, nil
+}
@@ -0,0 +1,123 @@
+package mkpkg
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestLinuxSnap(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Linux.IconPath = filepath.Join(filepath.Dir(p.LicensePath), "icon.png")
+	if err := ioutil.WriteFile(p.Linux.IconPath, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := p.linuxSnap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(path); got != "qri_0.5.0_amd64.snap" {
+		t.Errorf("snap name mismatch: %s", got)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 96 || string(data[:4]) != "hsqs" {
+		t.Fatalf("snap isn't a squashfs image")
+	}
+	if compression := binary.LittleEndian.Uint16(data[20:]); compression != 1 {
+		t.Errorf("expected gzip compression, got %d", compression)
+	}
+
+	snapcraft := snapYAML{}
+	data, err = ioutil.ReadFile(filepath.Join(p.OutDir, "snap-amd64", "snap", "snapcraft.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(data, &snapcraft); err != nil {
+		t.Fatal(err)
+	}
+	part := snapcraft.Parts["qri"]
+	want := snapPart{
+		Plugin:   "dump",
+		Source:   filepath.ToSlash(filepath.Dir(p.Linux.BinPath)),
+		Stage:    []string{"bin/qri"},
+		Organize: map[string]string{"qri": "bin/qri"},
+	}
+	if !reflect.DeepEqual(part, want) {
+		t.Errorf("snapcraft part mismatch.\ngot:  %#v\nwant: %#v", part, want)
+	}
+	if snapcraft.Architectures != nil {
+		t.Errorf("snapcraft.yaml shouldn't list architectures: %v", snapcraft.Architectures)
+	}
+
+	if _, err := exec.LookPath("unsquashfs"); err != nil {
+		return
+	}
+	out, err := exec.Command("unsquashfs", "-l", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("unsquashfs -l: %s\n%s", err, out)
+	}
+	for _, name := range []string{"bin/qri", "meta/snap.yaml", "meta/gui/icon.png", "meta/gui/qri.desktop"} {
+		if !strings.Contains(string(out), "squashfs-root/"+name+"\n") {
+			t.Errorf("snap missing %s:\n%s", name, out)
+		}
+	}
+}
+
+func TestSnapYAML(t *testing.T) {
+	p := Package{Name: "Qri CLI", BinName: "Qri", Version: "v0.5.0-rc1", Description: strings.Repeat("long summary ", 10)}
+	p.Linux.BinPath = filepath.Join("dist", "qri")
+	s, err := p.snapYAML("arm64", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "qri" || s.Version != "0.5.0-rc1" || s.Base != "core22" || s.Grade != "stable" || s.Confinement != "strict" {
+		t.Errorf("defaults mismatch: %#v", s)
+	}
+	if len(s.Summary) > 78 || !strings.HasSuffix(s.Summary, "...") {
+		t.Errorf("summary should be truncated to 78 characters: %q", s.Summary)
+	}
+	if !reflect.DeepEqual(s.Architectures, []string{"arm64"}) {
+		t.Errorf("architectures mismatch: %v", s.Architectures)
+	}
+	app := s.Apps["qri"]
+	if app.Command != "bin/Qri" || !reflect.DeepEqual(app.Plugs, []string{"home", "network"}) {
+		t.Errorf("app mismatch: %#v", app)
+	}
+
+	p.Snap = SnapConfig{Name: "qri-cli", Confinement: "classic", Plugs: []string{}}
+	if s, err = p.snapYAML("arm64", true); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "qri-cli" || s.Confinement != "classic" || len(s.Apps["qri-cli"].Plugs) != 0 {
+		t.Errorf("configured values mismatch: %#v", s)
+	}
+	// relative binary paths are made absolute, and the binary is staged at
+	// the path it's organized to
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	part := s.Parts["Qri"]
+	if part.Source != filepath.ToSlash(filepath.Join(wd, "dist")) || !reflect.DeepEqual(part.Stage, []string{"bin/Qri"}) || part.Organize["qri"] != "bin/Qri" {
+		t.Errorf("snapcraft part mismatch: %#v", part)
+	}
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "plugs") {
+		t.Errorf("empty plugs should be omitted:\n%s", data)
+	}
+}
@@ -0,0 +1,122 @@
+// Package squashfs writes squashfs 4.0 filesystem images, the format linux
+// mounts AppImage and snap packages from
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// magic number that opens every squashfs superblock: "hsqs"
+const magic = 0x73717368
+
+// superblockSize is the size of the superblock that begins every image
+const superblockSize = 96
+
+// metadataSize is the uncompressed size of inode, directory & id table blocks
+const metadataSize = 8192
+
+// DefaultBlockSize is the data block size used when none is configured
+const DefaultBlockSize = 128 * 1024
+
+// superblock flags
+const (
+	flagNoFragments = 0x0010
+	flagNoXattrs    = 0x0200
+)
+
+// invalidBlock marks an absent table in the superblock
+const invalidBlock = 0xFFFFFFFFFFFFFFFF
+
+// noFragment marks a file inode whose tail is stored as a full data block
+const noFragment = 0xFFFFFFFF
+
+// size flags marking blocks that are stored uncompressed
+const (
+	metadataUncompressed = 0x8000
+	dataUncompressed     = 1 << 24
+)
+
+// inode types
+const (
+	typeDir        = 1
+	typeFile       = 2
+	typeSymlink    = 3
+	typeLongDir    = 8
+	typeLongFile   = 9
+	noXattr        = 0xFFFFFFFF
+	maxDirEntries  = 256
+	maxInodeOffset = 1<<15 - 1
+)
+
+// Compression identifies the algorithm data & metadata blocks are
+// compressed with
+type Compression uint16
+
+const (
+	// Gzip compresses blocks with zlib, and is readable by every squashfs
+	// implementation
+	Gzip Compression = 1
+	// Zstd compresses blocks with zstandard, the default for AppImages
+	Zstd Compression = 6
+)
+
+// String implements the fmt.Stringer interface
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Compression(%d)", uint16(c))
+	}
+}
+
+// compressor returns a function that compresses a single block
+func (c Compression) compressor() (func([]byte) ([]byte, error), error) {
+	switch c {
+	case Gzip:
+		return func(data []byte) ([]byte, error) {
+			buf := &bytes.Buffer{}
+			zw, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := zw.Write(data); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}, nil
+	case Zstd:
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return func(data []byte) ([]byte, error) {
+			return enc.EncodeAll(data, nil), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("squashfs: unsupported compression: %s", c)
+	}
+}
+
+// FileHeader describes a file within a squashfs image
+type FileHeader struct {
+	// slash-separated path of the file within the image
+	Name string
+	// permission bits of the file
+	Mode os.FileMode
+	// last modification time. Default is the image modification time
+	ModTime time.Time
+	// owner & group ids. default to root
+	UID, GID int
+}
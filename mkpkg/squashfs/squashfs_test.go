@@ -0,0 +1,483 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// image is a squashfs image decoded by tests, independently of the writer
+type image struct {
+	t    *testing.T
+	data []byte
+
+	inodeCount   uint32
+	modTime      uint32
+	blockSize    uint32
+	compression  Compression
+	flags        uint16
+	rootRef      uint64
+	bytesUsed    uint64
+	ids          []uint32
+	inodes, dirs metadata
+}
+
+// metadata is a decompressed metadata table, with the uncompressed
+// position each block begins at keyed by the block's offset in the table
+type metadata struct {
+	data   []byte
+	blocks map[uint32]int
+}
+
+// inode is a decoded inode
+type inode struct {
+	typ         uint16
+	mode        os.FileMode
+	uid, gid    uint32
+	modTime     uint32
+	number      uint32
+	nlink       uint32
+	parent      uint32
+	body        []byte
+	target      string
+	children    []dirEntry
+	listingSize uint32
+}
+
+type dirEntry struct {
+	name   string
+	typ    uint16
+	number uint32
+	ref    uint64
+}
+
+func (img *image) decompress(data []byte) []byte {
+	img.t.Helper()
+	var (
+		out []byte
+		err error
+	)
+	switch img.compression {
+	case Gzip:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = ioutil.ReadAll(zr)
+		}
+	case Zstd:
+		var dec *zstd.Decoder
+		if dec, err = zstd.NewReader(nil); err == nil {
+			out, err = dec.DecodeAll(data, nil)
+			dec.Close()
+		}
+	default:
+		err = fmt.Errorf("unknown compression %d", img.compression)
+	}
+	if err != nil {
+		img.t.Fatalf("decompressing block: %s", err)
+	}
+	return out
+}
+
+// readMetadata decodes the metadata blocks between start & end
+func (img *image) readMetadata(start, end uint64) metadata {
+	img.t.Helper()
+	m := metadata{blocks: map[uint32]int{}}
+	for pos := start; pos < end; {
+		header := binary.LittleEndian.Uint16(img.data[pos:])
+		size := uint64(header &^ metadataUncompressed)
+		block := img.data[pos+2 : pos+2+size]
+		if header&metadataUncompressed == 0 {
+			block = img.decompress(block)
+		}
+		if len(block) > metadataSize {
+			img.t.Fatalf("metadata block of %d bytes", len(block))
+		}
+		m.blocks[uint32(pos-start)] = len(m.data)
+		m.data = append(m.data, block...)
+		pos += 2 + size
+	}
+	return m
+}
+
+// at returns metadata from a block offset & offset within the block
+func (m metadata) at(t *testing.T, block uint32, offset uint16) []byte {
+	t.Helper()
+	start, ok := m.blocks[block]
+	if !ok {
+		t.Fatalf("no metadata block at %d", block)
+	}
+	return m.data[start+int(offset):]
+}
+
+func readImage(t *testing.T, data []byte) *image {
+	t.Helper()
+	le := binary.LittleEndian
+	if len(data) < superblockSize || le.Uint32(data) != magic {
+		t.Fatalf("missing superblock magic")
+	}
+	if major, minor := le.Uint16(data[28:]), le.Uint16(data[30:]); major != 4 || minor != 0 {
+		t.Fatalf("unexpected version %d.%d", major, minor)
+	}
+	img := &image{
+		t:           t,
+		data:        data,
+		inodeCount:  le.Uint32(data[4:]),
+		modTime:     le.Uint32(data[8:]),
+		blockSize:   le.Uint32(data[12:]),
+		compression: Compression(le.Uint16(data[20:])),
+		flags:       le.Uint16(data[24:]),
+		rootRef:     le.Uint64(data[32:]),
+		bytesUsed:   le.Uint64(data[40:]),
+	}
+	if log := le.Uint16(data[22:]); 1<<log != img.blockSize {
+		t.Errorf("block log %d doesn't match block size %d", log, img.blockSize)
+	}
+	if img.bytesUsed > uint64(len(data)) {
+		t.Fatalf("bytes used %d exceeds image size %d", img.bytesUsed, len(data))
+	}
+	idTableStart := le.Uint64(data[48:])
+	if xattrs := le.Uint64(data[56:]); xattrs != invalidBlock {
+		t.Errorf("unexpected xattr table at %d", xattrs)
+	}
+	inodeTableStart, dirTableStart, fragmentTableStart := le.Uint64(data[64:]), le.Uint64(data[72:]), le.Uint64(data[80:])
+	if !(superblockSize <= inodeTableStart && inodeTableStart <= dirTableStart && dirTableStart <= fragmentTableStart && fragmentTableStart <= idTableStart) {
+		t.Fatalf("tables out of order: %d %d %d %d", inodeTableStart, dirTableStart, fragmentTableStart, idTableStart)
+	}
+	img.inodes = img.readMetadata(inodeTableStart, dirTableStart)
+	img.dirs = img.readMetadata(dirTableStart, fragmentTableStart)
+
+	idCount := int(le.Uint16(data[26:]))
+	ids := img.readMetadata(le.Uint64(data[idTableStart:]), idTableStart)
+	for i := 0; i < idCount; i++ {
+		img.ids = append(img.ids, le.Uint32(ids.data[i*4:]))
+	}
+	return img
+}
+
+// inode decodes the inode at ref
+func (img *image) inode(ref uint64) inode {
+	t := img.t
+	t.Helper()
+	le := binary.LittleEndian
+	b := img.inodes.at(t, uint32(ref>>16), uint16(ref))
+	in := inode{
+		typ:     le.Uint16(b),
+		mode:    os.FileMode(le.Uint16(b[2:])),
+		uid:     img.ids[le.Uint16(b[4:])],
+		gid:     img.ids[le.Uint16(b[6:])],
+		modTime: le.Uint32(b[8:]),
+		number:  le.Uint32(b[12:]),
+	}
+	b = b[16:]
+
+	var (
+		listingBlock, dataStart uint32
+		listingOffset           uint16
+		size                    uint64
+	)
+	switch in.typ {
+	case typeDir:
+		listingBlock, in.nlink = le.Uint32(b), le.Uint32(b[4:])
+		in.listingSize, listingOffset, in.parent = uint32(le.Uint16(b[8:])), le.Uint16(b[10:]), le.Uint32(b[12:])
+	case typeLongDir:
+		in.nlink, in.listingSize, listingBlock, in.parent = le.Uint32(b), le.Uint32(b[4:]), le.Uint32(b[8:]), le.Uint32(b[12:])
+		listingOffset = le.Uint16(b[18:])
+	case typeFile:
+		if frag := le.Uint32(b[4:]); frag != noFragment {
+			t.Fatalf("inode %d: unexpected fragment %d", in.number, frag)
+		}
+		dataStart, size = le.Uint32(b), uint64(le.Uint32(b[12:]))
+		in.body = img.fileData(uint64(dataStart), size, b[16:])
+	case typeLongFile:
+		in.nlink = le.Uint32(b[24:])
+		in.body = img.fileData(le.Uint64(b), le.Uint64(b[8:]), b[40:])
+	case typeSymlink:
+		in.nlink = le.Uint32(b)
+		in.target = string(b[8 : 8+le.Uint32(b[4:])])
+	default:
+		t.Fatalf("inode %d: unexpected type %d", in.number, in.typ)
+	}
+
+	if in.typ == typeDir || in.typ == typeLongDir {
+		// listing sizes count 3 bytes more than the listing holds
+		listing := img.dirs.at(t, listingBlock, listingOffset)[:in.listingSize-3]
+		for len(listing) > 0 {
+			count, block, first := le.Uint32(listing)+1, le.Uint32(listing[4:]), le.Uint32(listing[8:])
+			listing = listing[12:]
+			for i := uint32(0); i < count; i++ {
+				nameSize := int(le.Uint16(listing[6:])) + 1
+				in.children = append(in.children, dirEntry{
+					name:   string(listing[8 : 8+nameSize]),
+					typ:    le.Uint16(listing[4:]),
+					number: uint32(int64(first) + int64(int16(le.Uint16(listing[2:])))),
+					ref:    uint64(block)<<16 | uint64(le.Uint16(listing)),
+				})
+				listing = listing[8+nameSize:]
+			}
+		}
+	}
+	return in
+}
+
+// fileData reads size bytes of file data stored in blocks from start
+func (img *image) fileData(start, size uint64, sizes []byte) []byte {
+	var body []byte
+	for pos := start; uint64(len(body)) < size; sizes = sizes[4:] {
+		stored := binary.LittleEndian.Uint32(sizes)
+		n := uint64(stored &^ dataUncompressed)
+		block := img.data[pos : pos+n]
+		if stored&dataUncompressed == 0 {
+			block = img.decompress(block)
+		}
+		body = append(body, block...)
+		pos += n
+	}
+	if uint64(len(body)) != size {
+		img.t.Fatalf("file data is %d bytes, expected %d", len(body), size)
+	}
+	return body
+}
+
+// walk decodes every inode in the image, keyed by path
+func (img *image) walk() map[string]inode {
+	t := img.t
+	t.Helper()
+	files := map[string]inode{}
+	var visit func(name string, ref uint64, parent uint32)
+	visit = func(name string, ref uint64, parent uint32) {
+		in := img.inode(ref)
+		files[name] = in
+		if in.typ != typeDir && in.typ != typeLongDir {
+			return
+		}
+		if in.parent != parent {
+			t.Errorf("%s: parent inode %d, expected %d", name, in.parent, parent)
+		}
+		if !sort.SliceIsSorted(in.children, func(i, j int) bool { return in.children[i].name < in.children[j].name }) {
+			t.Errorf("%s: directory entries aren't sorted", name)
+		}
+		subdirs := 0
+		for _, c := range in.children {
+			child := img.inode(c.ref)
+			// entries record the basic type of extended inodes
+			basic := map[uint16]uint16{typeLongDir: typeDir, typeLongFile: typeFile}[child.typ]
+			if basic == 0 {
+				basic = child.typ
+			}
+			if child.number != c.number || basic != c.typ {
+				t.Errorf("%s/%s: entry inode %d type %d doesn't match inode %d type %d", name, c.name, c.number, c.typ, child.number, child.typ)
+			}
+			if c.typ == typeDir {
+				subdirs++
+			}
+			visit(path.Join(name, c.name), c.ref, in.number)
+		}
+		if in.nlink != uint32(2+subdirs) {
+			t.Errorf("%s: nlink %d, expected %d", name, in.nlink, 2+subdirs)
+		}
+	}
+	visit(".", img.rootRef, img.inodeCount+1)
+	if len(files) != int(img.inodeCount) {
+		t.Errorf("found %d inodes, superblock records %d", len(files), img.inodeCount)
+	}
+	return files
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	modTime := time.Unix(1560000000, 0)
+	fileTime := time.Unix(1500000000, 0)
+
+	// random data doesn't compress, & is stored in uncompressed blocks
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(random)
+	large := bytes.Repeat([]byte("qri "), 5000)
+
+	for _, compression := range []Compression{Gzip, Zstd} {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, WriterOptions{Compression: compression, BlockSize: 4096, ModTime: modTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Mkdir(FileHeader{Name: ".", Mode: 0700}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Mkdir(FileHeader{Name: "usr/share", Mode: 0750, UID: 1000, GID: 1001}); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string][]byte{
+			"AppRun":       []byte("#!/bin/sh\n"),
+			"usr/bin/qri":  large,
+			"usr/lib/rand": random,
+			"empty":        nil,
+		}
+		for name, body := range files {
+			mode := os.FileMode(0644)
+			if name == "AppRun" {
+				mode = 0755
+			}
+			if err := w.WriteFile(FileHeader{Name: name, Mode: mode, ModTime: fileTime, UID: 1000}, body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Symlink(FileHeader{Name: ".DirIcon"}, "usr/bin/qri"); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data := buf.Bytes()
+		if len(data)%4096 != 0 {
+			t.Errorf("%s: image size %d isn't padded to 4KiB", compression, len(data))
+		}
+		img := readImage(t, data)
+		if img.compression != compression || img.blockSize != 4096 || img.modTime != uint32(modTime.Unix()) {
+			t.Errorf("%s: superblock mismatch: %s %d %d", compression, img.compression, img.blockSize, img.modTime)
+		}
+		if img.flags != flagNoFragments|flagNoXattrs {
+			t.Errorf("%s: flags mismatch: %x", compression, img.flags)
+		}
+
+		got := img.walk()
+		var names []string
+		for name := range got {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if want := ".,.DirIcon,AppRun,empty,usr,usr/bin,usr/bin/qri,usr/lib,usr/lib/rand,usr/share"; strings.Join(names, ",") != want {
+			t.Errorf("%s: paths mismatch.\ngot:  %s\nwant: %s", compression, strings.Join(names, ","), want)
+		}
+		for name, body := range files {
+			in := got[name]
+			if in.typ != typeFile || !bytes.Equal(in.body, body) {
+				t.Errorf("%s: %s contents mismatch", compression, name)
+			}
+			if in.uid != 1000 || in.gid != 0 || in.modTime != uint32(fileTime.Unix()) {
+				t.Errorf("%s: %s details mismatch: %d:%d %d", compression, name, in.uid, in.gid, in.modTime)
+			}
+		}
+		if got["AppRun"].mode != 0755 || got["usr/bin/qri"].mode != 0644 {
+			t.Errorf("%s: file modes mismatch", compression)
+		}
+		if root := got["."]; root.mode != 0700 || root.modTime != uint32(modTime.Unix()) {
+			t.Errorf("%s: root details mismatch: %o %d", compression, root.mode, root.modTime)
+		}
+		if share := got["usr/share"]; share.mode != 0750 || share.uid != 1000 || share.gid != 1001 {
+			t.Errorf("%s: usr/share details mismatch: %o %d:%d", compression, share.mode, share.uid, share.gid)
+		}
+		if link := got[".DirIcon"]; link.typ != typeSymlink || link.target != "usr/bin/qri" || link.mode != 0777 {
+			t.Errorf("%s: symlink mismatch: %#v", compression, link)
+		}
+
+		unsquashfs(t, data, "squashfs-root/usr/bin/qri")
+	}
+}
+
+func TestWriterManyFiles(t *testing.T) {
+	// enough entries to span several metadata blocks & directory headers
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const count = 2000
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("share/%s-%04d", strings.Repeat("x", 40), i)
+		if err := w.WriteFile(FileHeader{Name: name, Mode: 0644}, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	img := readImage(t, buf.Bytes())
+	if len(img.inodes.blocks) < 2 || len(img.dirs.blocks) < 2 {
+		t.Errorf("expected multiple metadata blocks, got %d inode & %d directory blocks", len(img.inodes.blocks), len(img.dirs.blocks))
+	}
+	files := img.walk()
+	if len(files) != count+2 {
+		t.Fatalf("expected %d inodes, got %d", count+2, len(files))
+	}
+	share := files["share"]
+	if share.typ != typeLongDir {
+		t.Errorf("expected a long directory inode for a large listing, got type %d", share.typ)
+	}
+	for name, in := range files {
+		if in.typ == typeFile && string(in.body) != name {
+			t.Errorf("%s: contents mismatch: %q", name, in.body)
+		}
+	}
+
+	unsquashfs(t, buf.Bytes(), "squashfs-root/share/"+strings.Repeat("x", 40)+"-1999")
+}
+
+func TestWriterErrors(t *testing.T) {
+	for _, size := range []int{1000, 4097, 2 << 20} {
+		if _, err := NewWriter(ioutil.Discard, WriterOptions{BlockSize: size}); err == nil {
+			t.Errorf("expected error for block size %d", size)
+		}
+	}
+	if _, err := NewWriter(ioutil.Discard, WriterOptions{Compression: 3}); err == nil {
+		t.Errorf("expected unsupported compression error")
+	}
+
+	w, err := NewWriter(ioutil.Discard, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile(FileHeader{Name: "bin/qri"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile(FileHeader{Name: "/bin/qri"}, nil); err == nil {
+		t.Errorf("expected duplicate file error")
+	}
+	if err := w.WriteFile(FileHeader{Name: "bin/qri/config"}, nil); err == nil {
+		t.Errorf("expected not a directory error")
+	}
+	if err := w.Mkdir(FileHeader{Name: "bin/qri"}); err == nil {
+		t.Errorf("expected not a directory error")
+	}
+	if err := w.WriteFile(FileHeader{Name: "/"}, nil); err == nil {
+		t.Errorf("expected invalid name error")
+	}
+}
+
+// unsquashfs lists the image with unsquashfs if it's installed, checking
+// that it includes want
+func unsquashfs(t *testing.T, data []byte, want string) {
+	t.Helper()
+	if _, err := exec.LookPath("unsquashfs"); err != nil {
+		return
+	}
+	dir, err := ioutil.TempDir("", "mkpkg-squashfs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "image.squashfs")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("unsquashfs", "-l", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("unsquashfs -l: %s\n%s", err, out)
+	}
+	if !strings.Contains(string(out), want+"\n") {
+		t.Errorf("unsquashfs -l output missing %s:\n%s", want, out)
+	}
+}
@@ -0,0 +1,488 @@
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"path"
+	"sort"
+	"time"
+)
+
+// WriterOptions configures a Writer
+type WriterOptions struct {
+	// algorithm to compress blocks with. Default is Gzip
+	Compression Compression
+	// size of data blocks, a power of two between 4KiB and 1MiB. Default is
+	// DefaultBlockSize
+	BlockSize int
+	// image modification time. Default is the time the Writer is created
+	ModTime time.Time
+}
+
+// Writer creates a squashfs image. The superblock must precede file data,
+// so the image is buffered until Close is called
+type Writer struct {
+	w        io.Writer
+	opts     WriterOptions
+	compress func([]byte) ([]byte, error)
+	data     *bytes.Buffer
+	root     *node
+	nodes    map[string]*node
+}
+
+// node is a single file, directory or symlink in the image
+type node struct {
+	name     string
+	hdr      FileHeader
+	typ      uint16
+	children []*node
+
+	// file data location
+	start  uint64
+	size   uint64
+	blocks []uint32
+
+	// symlink target
+	target string
+
+	// assigned when the image is written
+	inode  uint32
+	ref    uint64
+	parent uint32
+	// directory listing location & size within the directory table
+	listingBlock  uint32
+	listingOffset uint16
+	listingSize   uint32
+}
+
+// NewWriter creates a squashfs Writer that writes to w
+func NewWriter(w io.Writer, opts WriterOptions) (*Writer, error) {
+	if opts.Compression == 0 {
+		opts.Compression = Gzip
+	}
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.BlockSize < 4096 || opts.BlockSize > 1<<20 || bits.OnesCount(uint(opts.BlockSize)) != 1 {
+		return nil, fmt.Errorf("squashfs: invalid block size: %d", opts.BlockSize)
+	}
+	if opts.ModTime.IsZero() {
+		opts.ModTime = time.Now()
+	}
+	compress, err := opts.Compression.compressor()
+	if err != nil {
+		return nil, err
+	}
+
+	root := &node{typ: typeDir, hdr: FileHeader{Mode: 0755, ModTime: opts.ModTime}}
+	return &Writer{
+		w:        w,
+		opts:     opts,
+		compress: compress,
+		data:     &bytes.Buffer{},
+		root:     root,
+		nodes:    map[string]*node{".": root},
+	}, nil
+}
+
+// Mkdir adds a directory to the image. Parent directories of files are
+// created automatically, Mkdir is only needed to set directory details or
+// add empty directories. Naming the root "." sets the root directory details
+func (w *Writer) Mkdir(hdr FileHeader) error {
+	name := path.Clean("/" + hdr.Name)[1:]
+	if name == "" {
+		w.root.hdr = w.header(hdr)
+		return nil
+	}
+	if n, ok := w.nodes[name]; ok {
+		if n.typ != typeDir {
+			return fmt.Errorf("squashfs: %s is not a directory", name)
+		}
+		n.hdr = w.header(hdr)
+		return nil
+	}
+	_, err := w.add(name, typeDir, hdr)
+	return err
+}
+
+// WriteFile adds a file with the given contents to the image
+func (w *Writer) WriteFile(hdr FileHeader, body []byte) error {
+	n, err := w.add(path.Clean("/" + hdr.Name)[1:], typeFile, hdr)
+	if err != nil {
+		return err
+	}
+
+	n.start = superblockSize + uint64(w.data.Len())
+	n.size = uint64(len(body))
+	for len(body) > 0 {
+		block := body
+		if len(block) > w.opts.BlockSize {
+			block = block[:w.opts.BlockSize]
+		}
+		body = body[len(block):]
+
+		compressed, err := w.compress(block)
+		if err != nil {
+			return err
+		}
+		if len(compressed) < len(block) {
+			n.blocks = append(n.blocks, uint32(len(compressed)))
+			w.data.Write(compressed)
+		} else {
+			n.blocks = append(n.blocks, uint32(len(block))|dataUncompressed)
+			w.data.Write(block)
+		}
+	}
+	return nil
+}
+
+// Symlink adds a symbolic link pointing to target to the image
+func (w *Writer) Symlink(hdr FileHeader, target string) error {
+	if hdr.Mode == 0 {
+		hdr.Mode = 0777
+	}
+	n, err := w.add(path.Clean("/" + hdr.Name)[1:], typeSymlink, hdr)
+	if err != nil {
+		return err
+	}
+	n.target = target
+	return nil
+}
+
+// header applies default details to hdr
+func (w *Writer) header(hdr FileHeader) FileHeader {
+	if hdr.ModTime.IsZero() {
+		hdr.ModTime = w.opts.ModTime
+	}
+	return hdr
+}
+
+// add creates a node named name, creating parent directories as needed
+func (w *Writer) add(name string, typ uint16, hdr FileHeader) (*node, error) {
+	if name == "" {
+		return nil, fmt.Errorf("squashfs: invalid name: %q", hdr.Name)
+	}
+	if _, ok := w.nodes[name]; ok {
+		return nil, fmt.Errorf("squashfs: duplicate file: %s", name)
+	}
+	if len(path.Base(name)) > 256 {
+		return nil, fmt.Errorf("squashfs: name too long: %s", name)
+	}
+
+	dir := path.Dir(name)
+	parent, ok := w.nodes[dir]
+	if !ok {
+		var err error
+		if parent, err = w.add(dir, typeDir, FileHeader{Mode: 0755}); err != nil {
+			return nil, err
+		}
+	}
+	if parent.typ != typeDir {
+		return nil, fmt.Errorf("squashfs: %s is not a directory", dir)
+	}
+
+	n := &node{name: path.Base(name), typ: typ, hdr: w.header(hdr)}
+	parent.children = append(parent.children, n)
+	w.nodes[name] = n
+	return n, nil
+}
+
+// Close writes the superblock, file data, and inode, directory & id tables
+// to the underlying writer. It does not close the underlying writer
+func (w *Writer) Close() error {
+	// number inodes depth-first, children before their parents, so every
+	// directory can be written after the entries it lists
+	var order []*node
+	var number func(n *node)
+	number = func(n *node) {
+		sort.Slice(n.children, func(i, j int) bool { return n.children[i].name < n.children[j].name })
+		for _, c := range n.children {
+			if c.typ == typeDir {
+				number(c)
+			}
+		}
+		for _, c := range n.children {
+			if c.typ != typeDir {
+				order = append(order, c)
+				c.inode = uint32(len(order))
+			}
+		}
+		order = append(order, n)
+		n.inode = uint32(len(order))
+	}
+	number(w.root)
+
+	ids := newIDTable()
+	inodes := newMetadataWriter(w.compress)
+	dirs := newMetadataWriter(w.compress)
+	var write func(n *node)
+	write = func(n *node) {
+		for _, c := range n.children {
+			if c.typ == typeDir {
+				c.parent = n.inode
+				write(c)
+			}
+		}
+		for _, c := range n.children {
+			if c.typ != typeDir {
+				c.ref = inodes.ref()
+				inodes.write(inodeBytes(c, ids))
+			}
+		}
+
+		listing := dirListing(n.children)
+		n.listingBlock, n.listingOffset = dirs.pos()
+		n.listingSize = uint32(len(listing)) + 3
+		dirs.write(listing)
+		n.ref = inodes.ref()
+		inodes.write(inodeBytes(n, ids))
+	}
+	w.root.parent = uint32(len(order)) + 1
+	write(w.root)
+
+	inodeTable, err := inodes.close()
+	if err != nil {
+		return err
+	}
+	dirTable, err := dirs.close()
+	if err != nil {
+		return err
+	}
+
+	// the id table is stored in metadata blocks, located by an index of
+	// block offsets
+	idMeta := newMetadataWriter(w.compress)
+	var idBlocks []uint32
+	for i, id := range ids.ids {
+		if i%(metadataSize/4) == 0 {
+			block, _ := idMeta.pos()
+			idBlocks = append(idBlocks, block)
+		}
+		idMeta.write(le32(id))
+	}
+	idTable, err := idMeta.close()
+	if err != nil {
+		return err
+	}
+
+	inodeTableStart := uint64(superblockSize + w.data.Len())
+	dirTableStart := inodeTableStart + uint64(len(inodeTable))
+	idMetaStart := dirTableStart + uint64(len(dirTable))
+	idTableStart := idMetaStart + uint64(len(idTable))
+	bytesUsed := idTableStart + uint64(8*len(idBlocks))
+
+	sb := &bytes.Buffer{}
+	for _, v := range []interface{}{
+		uint32(magic),
+		uint32(len(order)),
+		uint32(w.opts.ModTime.Unix()),
+		uint32(w.opts.BlockSize),
+		uint32(0), // fragment entry count
+		uint16(w.opts.Compression),
+		uint16(bits.TrailingZeros(uint(w.opts.BlockSize))),
+		uint16(flagNoFragments | flagNoXattrs),
+		uint16(len(ids.ids)),
+		uint16(4), // version major
+		uint16(0), // version minor
+		w.root.ref,
+		bytesUsed,
+		idTableStart,
+		uint64(invalidBlock), // xattr id table
+		inodeTableStart,
+		dirTableStart,
+		idMetaStart,          // empty fragment table
+		uint64(invalidBlock), // export table
+	} {
+		binary.Write(sb, binary.LittleEndian, v)
+	}
+
+	for _, chunk := range [][]byte{sb.Bytes(), w.data.Bytes(), inodeTable, dirTable, idTable} {
+		if _, err := w.w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	for _, block := range idBlocks {
+		if _, err := w.w.Write(le64(idMetaStart + uint64(block))); err != nil {
+			return err
+		}
+	}
+
+	// images are padded to a multiple of 4KiB so they can be loop mounted
+	if pad := bytesUsed % 4096; pad != 0 {
+		if _, err := w.w.Write(make([]byte, 4096-pad)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inodeBytes encodes the inode for n
+func inodeBytes(n *node, ids *idTable) []byte {
+	buf := &bytes.Buffer{}
+	put := func(vs ...interface{}) {
+		for _, v := range vs {
+			binary.Write(buf, binary.LittleEndian, v)
+		}
+	}
+
+	typ := n.typ
+	switch {
+	case n.typ == typeDir && n.listingSize > 0xFFFF:
+		typ = typeLongDir
+	case n.typ == typeFile && (n.start > 0xFFFFFFFF || n.size > 0xFFFFFFFF):
+		typ = typeLongFile
+	}
+	put(typ, uint16(n.hdr.Mode.Perm()), ids.index(n.hdr.UID), ids.index(n.hdr.GID), uint32(n.hdr.ModTime.Unix()), n.inode)
+
+	switch typ {
+	case typeDir:
+		put(n.listingBlock, uint32(2+subdirs(n)), uint16(n.listingSize), n.listingOffset, n.parent)
+	case typeLongDir:
+		put(uint32(2+subdirs(n)), n.listingSize, n.listingBlock, n.parent, uint16(0), n.listingOffset, uint32(noXattr))
+	case typeFile:
+		put(uint32(n.start), uint32(noFragment), uint32(0), uint32(n.size), n.blocks)
+	case typeLongFile:
+		put(n.start, n.size, uint64(0), uint32(1), uint32(noFragment), uint32(0), uint32(noXattr), n.blocks)
+	case typeSymlink:
+		put(uint32(1), uint32(len(n.target)), []byte(n.target))
+	}
+	return buf.Bytes()
+}
+
+// subdirs counts the directories within n
+func subdirs(n *node) (count int) {
+	for _, c := range n.children {
+		if c.typ == typeDir {
+			count++
+		}
+	}
+	return count
+}
+
+// dirListing encodes the directory table listing of children, which must be
+// sorted by name and have inode references assigned. entries are grouped
+// under headers that share an inode metadata block
+func dirListing(children []*node) []byte {
+	buf := &bytes.Buffer{}
+	put := func(vs ...interface{}) {
+		for _, v := range vs {
+			binary.Write(buf, binary.LittleEndian, v)
+		}
+	}
+
+	for i := 0; i < len(children); {
+		first := children[i]
+		block := uint32(first.ref >> 16)
+		count := 0
+		for _, c := range children[i:] {
+			delta := int64(c.inode) - int64(first.inode)
+			if count == maxDirEntries || uint32(c.ref>>16) != block || delta > maxInodeOffset || delta < -maxInodeOffset {
+				break
+			}
+			count++
+		}
+
+		put(uint32(count-1), block, first.inode)
+		for _, c := range children[i : i+count] {
+			put(uint16(c.ref&0xFFFF), int16(int64(c.inode)-int64(first.inode)), c.typ, uint16(len(c.name)-1), []byte(c.name))
+		}
+		i += count
+	}
+	return buf.Bytes()
+}
+
+// idTable collects the distinct uids & gids used by inodes
+type idTable struct {
+	ids     []uint32
+	indexes map[uint32]uint16
+}
+
+func newIDTable() *idTable {
+	return &idTable{indexes: map[uint32]uint16{}}
+}
+
+// index returns the table index of id, adding it if needed
+func (t *idTable) index(id int) uint16 {
+	if i, ok := t.indexes[uint32(id)]; ok {
+		return i
+	}
+	i := uint16(len(t.ids))
+	t.ids = append(t.ids, uint32(id))
+	t.indexes[uint32(id)] = i
+	return i
+}
+
+// metadataWriter splits a stream into compressed 8KiB metadata blocks, each
+// prefixed with its stored size
+type metadataWriter struct {
+	compress func([]byte) ([]byte, error)
+	out      *bytes.Buffer
+	pending  []byte
+	err      error
+}
+
+func newMetadataWriter(compress func([]byte) ([]byte, error)) *metadataWriter {
+	return &metadataWriter{compress: compress, out: &bytes.Buffer{}}
+}
+
+// pos returns the offset of the current block within the table, and the
+// offset of the next write within the uncompressed block
+func (m *metadataWriter) pos() (block uint32, offset uint16) {
+	return uint32(m.out.Len()), uint16(len(m.pending))
+}
+
+// ref returns the position of the next write as an inode reference
+func (m *metadataWriter) ref() uint64 {
+	block, offset := m.pos()
+	return uint64(block)<<16 | uint64(offset)
+}
+
+func (m *metadataWriter) write(p []byte) {
+	m.pending = append(m.pending, p...)
+	for len(m.pending) >= metadataSize {
+		m.flush(m.pending[:metadataSize])
+		m.pending = m.pending[metadataSize:]
+	}
+}
+
+func (m *metadataWriter) flush(block []byte) {
+	if m.err != nil {
+		return
+	}
+	compressed, err := m.compress(block)
+	if err != nil {
+		m.err = err
+		return
+	}
+	if len(compressed) < len(block) {
+		binary.Write(m.out, binary.LittleEndian, uint16(len(compressed)))
+		m.out.Write(compressed)
+		return
+	}
+	binary.Write(m.out, binary.LittleEndian, uint16(len(block))|metadataUncompressed)
+	m.out.Write(block)
+}
+
+// close flushes any remaining data, returning the encoded table
+func (m *metadataWriter) close() ([]byte, error) {
+	if len(m.pending) > 0 {
+		m.flush(m.pending)
+		m.pending = nil
+	}
+	return m.out.Bytes(), m.err
+}
+
+func le32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func le64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,99 @@
+package mkpkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// tarballName returns the base name shared by the tarball and its top-level
+// directory, eg: qri-v0.5.0-linux-amd64
+func (p Package) tarballName() string {
+	return fmt.Sprintf("%s-%s-linux-%s", p.BinName, p.Version, p.Linux.arch())
+}
+
+func (p Package) linuxTarball() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	bin, err := ioutil.ReadFile(p.Linux.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	installSh, err := p.execTemplate(installShTmpl)
+	if err != nil {
+		return "", err
+	}
+
+	base := p.tarballName()
+	files := []archiveFile{
+		{Name: path.Join(base, p.BinName), Mode: 0755, Body: bin},
+		{Name: path.Join(base, "install.sh"), Mode: 0755, Body: []byte(installSh)},
+	}
+
+	if p.LicensePath != "" {
+		b, err := ioutil.ReadFile(p.LicensePath)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, archiveFile{Name: path.Join(base, "LICENSE"), Mode: 0644, Body: b})
+	}
+	if p.ReadmePath != "" {
+		b, err := ioutil.ReadFile(p.ReadmePath)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, archiveFile{Name: path.Join(base, "README"+filepath.Ext(p.ReadmePath)), Mode: 0644, Body: b})
+	}
+
+	f, err := os.Create(filepath.Join(outDir, base+".tar.gz"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := writeTarGz(f, withParentDirs(files)); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// installShTmpl installs the binary to /usr/local/[BinName]/bin and adds it
+// to PATH with an /etc/profile.d entry, mirroring the darwin installer
+const installShTmpl = `#!/bin/sh
+# install {{ .Name }} {{ .Version }}
+set -e
+
+PROJROOT=/usr/local/{{ .BinName }}
+PROFILE=/etc/profile.d/{{ .BinName }}.sh
+SRC="$(cd "$(dirname "$0")" && pwd)"
+
+if [ "$(id -u)" -ne 0 ]; then
+  echo "install.sh must be run as root, try: sudo $0"
+  exit 1
+fi
+
+if [ -d $PROJROOT ]; then
+  echo "Removing previous installation"
+  rm -r $PROJROOT
+fi
+
+echo "Installing {{ .BinName }} to $PROJROOT"
+mkdir -p $PROJROOT/bin
+cp "$SRC/{{ .BinName }}" $PROJROOT/bin/{{ .BinName }}
+chmod 755 $PROJROOT/bin/{{ .BinName }}
+
+echo "Adding $PROJROOT/bin to PATH"
+echo 'export PATH="$PATH:/usr/local/{{ .BinName }}/bin"' > $PROFILE
+chmod 644 $PROFILE
+
+echo "{{ .Name }} installed. open a new shell, or run: . $PROFILE"
+`
@@ -0,0 +1,51 @@
+package mkpkg
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinuxTarball(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path, err := p.linuxTarball()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(path); got != "qri-v0.5.0-linux-amd64.tar.gz" {
+		t.Errorf("tarball name mismatch: %s", got)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readTarGz(t, data)
+	want := "qri-v0.5.0-linux-amd64/,qri-v0.5.0-linux-amd64/LICENSE,qri-v0.5.0-linux-amd64/README.md,qri-v0.5.0-linux-amd64/install.sh,qri-v0.5.0-linux-amd64/qri"
+	if got := strings.Join(tarNames(entries), ","); got != want {
+		t.Errorf("entries mismatch.\ngot:  %s\nwant: %s", got, want)
+	}
+	bin := tarFile(t, entries, "qri-v0.5.0-linux-amd64/qri")
+	if string(bin.Body) != testBin || bin.Header.Mode != 0755 {
+		t.Errorf("binary mismatch. mode: %o body: %q", bin.Header.Mode, bin.Body)
+	}
+
+	install := tarFile(t, entries, "qri-v0.5.0-linux-amd64/install.sh")
+	if !strings.Contains(string(install.Body), "PROJROOT=/usr/local/qri") {
+		t.Errorf("install.sh wasn't rendered:\n%s", install.Body)
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		return
+	}
+	script := filepath.Join(filepath.Dir(path), "install.sh")
+	if err := ioutil.WriteFile(script, install.Body, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("sh", "-n", script).CombinedOutput(); err != nil {
+		t.Errorf("install.sh has syntax errors: %s\n%s", err, out)
+	}
+}
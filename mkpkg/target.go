@@ -0,0 +1,210 @@
+package mkpkg
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Target is an operating system & architecture to create packages for
+type Target struct {
+	// operating system using go's GOOS naming, eg: linux
+	OS string
+	// architecture using go's GOARCH naming, eg: amd64. Default is the
+	// architecture mkpkg is running on
+	Arch string
+	// package formats to create, eg: [deb, rpm]. Default is the default
+	// format for OS
+	Formats []string
+	// Path to the binary for this target. Overrides Package.BinPath, and is a
+	// template in the same way
+	BinPath string
+}
+
+// arch returns the configured GOARCH-style architecture, defaulting to the
+// architecture of the running process
+func (t Target) arch() string {
+	if t.Arch == "" {
+		return runtime.GOARCH
+	}
+	return t.Arch
+}
+
+// String describes the target, eg: linux/amd64. targets without an Arch are
+// described by OS alone
+func (t Target) String() string {
+	if t.Arch == "" {
+		return t.OS
+	}
+	return t.OS + "/" + t.Arch
+}
+
+// ForTarget returns a copy of the package configured to build for t, with
+// binary paths of t's operating system set, and architectures if t has one
+func (p Package) ForTarget(t Target) (Package, error) {
+	arch := t.Arch
+	binPath := t.BinPath
+	if binPath == "" {
+		binPath = p.BinPath
+	}
+	if binPath != "" {
+		path, err := renderTemplate(binPath, struct {
+			Package
+			OS, Arch, Ext string
+		}{p, t.OS, t.arch(), ext(t.OS)})
+		if err != nil {
+			return p, fmt.Errorf("rendering BinPath for %s: %s", t, err)
+		}
+		binPath = path
+	}
+
+	switch t.OS {
+	case "darwin":
+		if arch != "" {
+			p.Darwin.Arch = arch
+		}
+		if binPath != "" {
+			p.Darwin.BinPath = binPath
+		}
+	case "linux":
+		if arch != "" {
+			p.Linux.Arch = arch
+		}
+		if binPath != "" {
+			p.Linux.BinPath = binPath
+		}
+	case "windows":
+		if arch != "" {
+			p.MSI.Arch, p.NSIS.Arch, p.Zip.Arch = arch, arch, arch
+		}
+		if binPath != "" {
+			p.MSI.BinPath, p.NSIS.BinPath, p.Zip.BinPath = binPath, binPath, binPath
+		}
+	case "freebsd":
+		if arch != "" {
+			p.FreeBSD.Arch = arch
+		}
+		if binPath != "" {
+			p.FreeBSD.BinPath = binPath
+		}
+	}
+	return p, nil
+}
+
+// Job is a single package to create: one format of one target
+type Job struct {
+	Target Target
+	// Package configured for Target
+	Package Package
+	Builder Builder
+}
+
+// String describes the job, eg: linux/amd64 deb
+func (j Job) String() string {
+	return j.Target.String() + " " + j.Builder.Name()
+}
+
+// Run creates the job's package
+func (j Job) Run(ctx context.Context) ([]Artifact, error) {
+	if err := j.Builder.Available(j.Package); err != nil {
+		return nil, fmt.Errorf("can't create %s package: %s", j, err)
+	}
+	artifacts, err := j.Builder.Build(ctx, j.Package)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s package: %s", j, err)
+	}
+	for i, a := range artifacts {
+		if a.Arch == "" {
+			artifacts[i].Arch = j.Target.arch()
+		}
+	}
+	return artifacts, nil
+}
+
+// Jobs lists every package to create for the configured Targets
+func (p Package) Jobs() ([]Job, error) {
+	if len(p.Targets) == 0 {
+		return nil, fmt.Errorf("no Targets configured")
+	}
+
+	var jobs []Job
+	for _, t := range p.Targets {
+		tp, err := p.ForTarget(t)
+		if err != nil {
+			return nil, err
+		}
+		formats := t.Formats
+		if len(formats) == 0 {
+			formats = []string{""}
+		}
+		for _, format := range formats {
+			b, err := LookupBuilder(t.OS, format)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, Job{Target: t, Package: tp, Builder: b})
+		}
+	}
+	return jobs, nil
+}
+
+// MakeAll creates packages in every format for every configured target,
+// running one job per CPU at a time
+func (p Package) MakeAll(ctx context.Context) ([]Artifact, error) {
+	jobs, err := p.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	results, err := RunJobs(ctx, jobs, 0)
+	var artifacts []Artifact
+	for _, a := range results {
+		artifacts = append(artifacts, a...)
+	}
+	return artifacts, err
+}
+
+// RunJobs runs jobs concurrently, at most parallel at a time. parallel less
+// than one runs one job per CPU. Artifacts are returned in job order. The
+// first job to fail cancels the rest, and its error is returned. Jobs that
+// haven't started when ctx is cancelled are skipped
+func RunJobs(ctx context.Context, jobs []Job, parallel int) ([][]Artifact, error) {
+	if parallel < 1 {
+		parallel = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, parallel)
+		results  = make([][]Artifact, len(jobs))
+	)
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j Job) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// jobs waiting for a slot when another fails or ctx is cancelled
+			// don't start
+			var artifacts []Artifact
+			err := ctx.Err()
+			if err == nil {
+				artifacts, err = j.Run(ctx)
+			}
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = artifacts
+		}(i, j)
+	}
+	wg.Wait()
+	return results, firstErr
+}
@@ -0,0 +1,248 @@
+package mkpkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTargetString(t *testing.T) {
+	if got := (Target{OS: "linux", Arch: "arm64"}).String(); got != "linux/arm64" {
+		t.Errorf("string mismatch: %s", got)
+	}
+	if got := (Target{OS: "darwin"}).String(); got != "darwin" {
+		t.Errorf("string mismatch: %s", got)
+	}
+}
+
+func TestForTarget(t *testing.T) {
+	p := Package{
+		Name:    "Qri CLI",
+		BinName: "qri",
+		BinPath: "dist/{{ .OS }}_{{ .Arch }}/{{ .BinName }}{{ .Ext }}",
+		Linux:   LinuxConfig{Arch: "386", BinPath: "unused"},
+	}
+
+	linux, err := p.ForTarget(Target{OS: "linux", Arch: "arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linux.Linux.Arch != "arm64" || linux.Linux.BinPath != "dist/linux_arm64/qri" {
+		t.Errorf("linux config mismatch: %#v", linux.Linux)
+	}
+	if p.Linux.Arch != "386" {
+		t.Errorf("ForTarget modified the original package")
+	}
+
+	win, err := p.ForTarget(Target{OS: "windows", Arch: "386"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string][2]string{
+		"MSI":  {win.MSI.Arch, win.MSI.BinPath},
+		"NSIS": {win.NSIS.Arch, win.NSIS.BinPath},
+		"Zip":  {win.Zip.Arch, win.Zip.BinPath},
+	} {
+		if cfg[0] != "386" || cfg[1] != "dist/windows_386/qri.exe" {
+			t.Errorf("%s config mismatch: %v", name, cfg)
+		}
+	}
+
+	// targets without an arch render the host architecture, and leave
+	// configured architectures alone
+	host, err := p.ForTarget(Target{OS: "linux", BinPath: "bin/{{ .Arch }}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Linux.Arch != "386" || host.Linux.BinPath != "bin/"+runtime.GOARCH {
+		t.Errorf("host target config mismatch: %#v", host.Linux)
+	}
+
+	darwin, err := p.ForTarget(Target{OS: "darwin", Arch: "arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if darwin.Darwin.Arch != "arm64" || darwin.Darwin.BinPath != "dist/darwin_arm64/qri" {
+		t.Errorf("darwin config mismatch: %#v", darwin.Darwin)
+	}
+
+	p.BinPath = "{{ .Missing }}"
+	if _, err := p.ForTarget(Target{OS: "linux"}); err == nil {
+		t.Error("expected an error rendering a bad BinPath template")
+	}
+}
+
+func TestJobs(t *testing.T) {
+	p := Package{
+		BinPath: "dist/{{ .OS }}_{{ .Arch }}/qri{{ .Ext }}",
+		Targets: []Target{
+			{OS: "darwin", Arch: "amd64"},
+			{OS: "linux", Arch: "amd64", Formats: []string{"deb", "rpm"}},
+			{OS: "linux", Arch: "arm64", Formats: []string{"deb"}},
+			{OS: "windows", Arch: "386", Formats: []string{"msi", "zip"}},
+		},
+	}
+	jobs, err := p.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, j := range jobs {
+		got = append(got, j.String()+" "+j.BinPath())
+	}
+	want := []string{
+		"darwin/amd64 pkg dist/darwin_amd64/qri",
+		"linux/amd64 deb dist/linux_amd64/qri",
+		"linux/amd64 rpm dist/linux_amd64/qri",
+		"linux/arm64 deb dist/linux_arm64/qri",
+		"windows/386 msi dist/windows_386/qri.exe",
+		"windows/386 zip dist/windows_386/qri.exe",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("jobs mismatch.\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, err := (Package{}).Jobs(); err == nil {
+		t.Error("expected an error without Targets")
+	}
+	p.Targets = []Target{{OS: "linux", Formats: []string{"exe"}}}
+	if _, err := p.Jobs(); err == nil || !strings.Contains(err.Error(), `"exe"`) {
+		t.Errorf("expected an unsupported format error, got: %v", err)
+	}
+}
+
+// fakeBuilder is a Builder that runs build instead of creating a package
+type fakeBuilder struct {
+	name  string
+	build func(ctx context.Context) error
+}
+
+func (b fakeBuilder) Name() string              { return b.name }
+func (b fakeBuilder) Target() string            { return "test" }
+func (b fakeBuilder) Available(p Package) error { return nil }
+func (b fakeBuilder) Build(ctx context.Context, p Package) ([]Artifact, error) {
+	if err := b.build(ctx); err != nil {
+		return nil, err
+	}
+	return []Artifact{{Format: b.name, OS: "test"}}, nil
+}
+
+func TestRunJobs(t *testing.T) {
+	var jobs []Job
+	for i := 0; i < 4; i++ {
+		jobs = append(jobs, Job{
+			Target:  Target{OS: "test", Arch: "amd64"},
+			Builder: fakeBuilder{name: strconv.Itoa(i), build: func(context.Context) error { return nil }},
+		})
+	}
+	results, err := RunJobs(context.Background(), jobs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if len(r) != 1 || r[0].Format != strconv.Itoa(i) || r[0].Arch != "amd64" {
+			t.Errorf("job %d result mismatch: %#v", i, r)
+		}
+	}
+}
+
+func TestRunJobsCancel(t *testing.T) {
+	// the second job waits to be cancelled by the first failing
+	jobs := []Job{
+		{Target: Target{OS: "test"}, Builder: fakeBuilder{name: "fail", build: func(context.Context) error {
+			return errors.New("failed")
+		}}},
+		{Target: Target{OS: "test"}, Builder: fakeBuilder{name: "wait", build: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}},
+	}
+	results, err := RunJobs(context.Background(), jobs, 2)
+	if !strings.Contains(fmt.Sprint(err), "failed") {
+		t.Errorf("expected the first failure to be returned, got: %v", err)
+	}
+	if results[0] != nil || results[1] != nil {
+		t.Errorf("failed jobs shouldn't have results: %v", results)
+	}
+
+	// with one slot, whichever job runs first fails, and jobs queued behind
+	// it never start
+	var started int32
+	jobs = nil
+	for i := 0; i < 8; i++ {
+		jobs = append(jobs, Job{Target: Target{OS: "test"}, Builder: fakeBuilder{name: "fail", build: func(context.Context) error {
+			atomic.AddInt32(&started, 1)
+			return errors.New("failed")
+		}}})
+	}
+	if _, err := RunJobs(context.Background(), jobs, 1); err == nil {
+		t.Error("expected an error")
+	}
+	if n := atomic.LoadInt32(&started); n != 1 {
+		t.Errorf("expected one job to start, %d did", n)
+	}
+
+	// nothing starts once ctx is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	atomic.StoreInt32(&started, 0)
+	if _, err := RunJobs(ctx, jobs, 1); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+	if n := atomic.LoadInt32(&started); n != 0 {
+		t.Errorf("%d jobs started after ctx was cancelled", n)
+	}
+}
+
+func TestConcurrentArchBuilds(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Targets = []Target{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "darwin", Arch: "arm64"},
+		{OS: "freebsd", Arch: "amd64"},
+		{OS: "freebsd", Arch: "arm64"},
+		{OS: "linux", Arch: "amd64", Formats: []string{"snap", "flatpak", "pacman", "apk", "deb", "rpm", "tar.gz"}},
+		{OS: "linux", Arch: "arm64", Formats: []string{"snap", "flatpak", "pacman", "apk", "deb", "rpm", "tar.gz"}},
+		{OS: "windows", Arch: "amd64", Formats: []string{"zip"}},
+		{OS: "windows", Arch: "386", Formats: []string{"zip"}},
+	}
+	jobs, err := p.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := RunJobs(context.Background(), jobs, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// builds of one format for different architectures run at once, and
+	// mustn't write the same file
+	paths := map[string]string{}
+	for i, artifacts := range results {
+		for _, a := range artifacts {
+			if other, ok := paths[a.Path]; ok {
+				t.Errorf("%s and %s both wrote %s", other, jobs[i], a.Path)
+			}
+			paths[a.Path] = jobs[i].String()
+		}
+	}
+	for _, name := range []string{
+		"snap-amd64/snap/snapcraft.yaml",
+		"snap-arm64/snap/snapcraft.yaml",
+		"flatpak-amd64/io.qri.cli.json",
+		"flatpak-arm64/io.qri.cli.json",
+		"PKGBUILD-x86_64",
+		"PKGBUILD-aarch64",
+	} {
+		if _, err := os.Stat(filepath.Join(p.OutDir, name)); err != nil {
+			t.Errorf("missing per-architecture file: %s", err)
+		}
+	}
+}
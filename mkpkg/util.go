@@ -1,23 +1,24 @@
 package mkpkg
 
 import (
+	"bytes"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 )
 
-// TODO - remove this stuff
-const storageBase = "https://storage.googleapis.com/go-builder-data/release/"
-
 // writeDataFiles writes the files in the provided map to the provided base
-// directory. If the map value is a URL it fetches the data at that URL and
-// uses it as the file contents.
+// directory. Files starting with #! are scripts, and are made executable
 func writeDataFiles(data map[string]string, base string) error {
 	for name, body := range data {
 		dst := filepath.Join(base, name)
@@ -25,16 +26,12 @@ func writeDataFiles(data map[string]string, base string) error {
 		if err != nil {
 			return err
 		}
-		b := []byte(body)
-		if strings.HasPrefix(body, storageBase) {
-			b, err = httpGet(body)
-			if err != nil {
-				return err
-			}
+		// scripts are executable, everything else is plain data
+		mode := os.FileMode(0644)
+		if strings.HasPrefix(body, "#!") {
+			mode = 0755
 		}
-		// (We really mean 0755 on the next line; some of these files
-		// are executable, and there's no harm in making them all so.)
-		if err := ioutil.WriteFile(dst, b, 0755); err != nil {
+		if err := ioutil.WriteFile(dst, []byte(body), mode); err != nil {
 			return err
 		}
 	}
@@ -57,16 +54,19 @@ func httpGet(url string) ([]byte, error) {
 	return body, nil
 }
 
+// run executes a command. command output is written to stderr, leaving
+// stdout to programs using mkpkg
 func run(name string, arg ...string) error {
 	cmd := exec.Command(name, arg...)
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
 	return cmd.Run()
 }
 
+// runDir executes a command in dir, writing output to stderr
 func runDir(dir, name string, arg ...string) error {
 	cmd := exec.Command(name, arg...)
 	cmd.Dir = dir
-	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
 	return cmd.Run()
 }
 
@@ -129,9 +129,57 @@ func cpAllDir(dst, basePath string, dirs ...string) error {
 	return nil
 }
 
-func ext() string {
-	if runtime.GOOS == "windows" {
+// ext returns the file extension of executables built for goos
+func ext(goos string) string {
+	if goos == "windows" {
 		return ".exe"
 	}
 	return ""
 }
+
+// xmlEscape escapes s for use as xml character data
+func xmlEscape(s string) string {
+	buf := &bytes.Buffer{}
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
+
+// publishedArtifact is a built package, and the url it's published at
+type publishedArtifact struct {
+	Artifact
+	URL string
+}
+
+// publishedArtifacts selects built packages of goos & format, rendering
+// urlTmpl to get the url each is published at. Templates have access to all
+// Package fields, and File, the package file name escaped for use in a url.
+// Packages are returned one per architecture, sorted by architecture
+func (p Package) publishedArtifacts(urlTmpl string, artifacts []Artifact, goos, format string) ([]publishedArtifact, error) {
+	var list []publishedArtifact
+	seen := map[string]bool{}
+	for _, a := range artifacts {
+		if a.OS != goos || a.Format != format {
+			continue
+		}
+		if a.SHA256 == "" {
+			return nil, fmt.Errorf("%s has no sha256", a.Path)
+		}
+		if seen[a.Arch] {
+			return nil, fmt.Errorf("more than one %s %s package for %q", goos, format, a.Arch)
+		}
+		seen[a.Arch] = true
+		link, err := renderTemplate(urlTmpl, struct {
+			Package
+			File string
+		}{p, url.PathEscape(filepath.Base(a.Path))})
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, publishedArtifact{Artifact: a, URL: strings.TrimSpace(link)})
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no %s %s packages were created", goos, format)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Arch < list[j].Arch })
+	return list, nil
+}
@@ -0,0 +1,37 @@
+package mkpkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteDataFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkpkg-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = writeDataFiles(map[string]string{
+		"scripts/postinstall": "#!/bin/sh\necho hi\n",
+		"Formula/qri.rb":      "class Qri < Formula\nend\n",
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{
+		"scripts/postinstall": 0755,
+		"Formula/qri.rb":      0644,
+	} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// umask can only remove permissions
+		if got := fi.Mode().Perm(); got&^want != 0 || (want&0100 != 0) != (got&0100 != 0) {
+			t.Errorf("%s: mode mismatch. got: %s, want: %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package mkpkg
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Problems lists issues with package-wide configuration that would stop
+// packages from being created. An empty list means no problems were found
+func (p Package) Problems() []string {
+	var problems []string
+	for field, value := range map[string]string{"Name": p.Name, "BinName": p.BinName, "Version": p.Version} {
+		if value == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", field))
+		}
+	}
+	for field, path := range map[string]string{
+		"LicensePath":               p.LicensePath,
+		"ReadmePath":                p.ReadmePath,
+		"Darwin.BgPngPath":          p.Darwin.BgPngPath,
+		"Linux.IconPath":            p.Linux.IconPath,
+		"Linux.AppImageRuntimePath": p.Linux.AppImageRuntimePath,
+		"MSI.IconPath":              p.MSI.IconPath,
+		"NSIS.IconPath":             p.NSIS.IconPath,
+	} {
+		if problem := missingFile(field, path); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	// map iteration order is random, keep problems stable between runs
+	sort.Strings(problems)
+	return problems
+}
+
+// BinPath returns the path of the binary the job packages, or an empty
+// string if the job's builder isn't one mkpkg provides
+func (j Job) BinPath() string {
+	if b, ok := j.Builder.(builder); ok && b.binPath != nil {
+		return b.binPath(j.Package)
+	}
+	return ""
+}
+
+// Problems lists issues that would stop the job's package from being
+// created. An empty list means no problems were found
+func (j Job) Problems() []string {
+	// builders mkpkg doesn't provide check their own configuration
+	b, ok := j.Builder.(builder)
+	if !ok {
+		return nil
+	}
+
+	var problems []string
+	if path := j.BinPath(); path == "" {
+		problems = append(problems, fmt.Sprintf("%s: binary path is required", j))
+	} else if problem := missingFile("binary", path); problem != "" {
+		problems = append(problems, fmt.Sprintf("%s: %s", j, problem))
+	}
+	if b.required != nil {
+		for _, field := range b.required(j.Package) {
+			problems = append(problems, fmt.Sprintf("%s: %s is required", j, field))
+		}
+	}
+	return problems
+}
+
+// identifierRequired checks for the app identifier darwin packages &
+// flatpaks are named by
+func identifierRequired(p Package) []string {
+	if p.Identifier == "" {
+		return []string{"Identifier"}
+	}
+	return nil
+}
+
+// appImageRequired checks for the icon & runtime every AppImage needs
+func appImageRequired(p Package) []string {
+	var missing []string
+	if p.Linux.IconPath == "" {
+		missing = append(missing, "Linux.IconPath")
+	}
+	if p.Linux.AppImageRuntimePath == "" {
+		missing = append(missing, "Linux.AppImageRuntimePath")
+	}
+	return missing
+}
+
+// missingFile describes a configured path that doesn't exist. empty paths
+// aren't configured, and aren't a problem
+func missingFile(field, path string) string {
+	if path == "" {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Sprintf("%s %q not found", field, path)
+	}
+	return ""
+}
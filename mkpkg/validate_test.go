@@ -0,0 +1,68 @@
+package mkpkg
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackageProblems(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	if problems := p.Problems(); len(problems) != 0 {
+		t.Errorf("expected no problems, got: %v", problems)
+	}
+
+	p.Name, p.BinName, p.Version = "", "", ""
+	p.Linux.IconPath = filepath.Join(p.OutDir, "missing.png")
+	got := p.Problems()
+	want := []string{
+		"BinName is required",
+		`Linux.IconPath "` + p.Linux.IconPath + `" not found`,
+		"Name is required",
+		"Version is required",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems mismatch.\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestJobProblems(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.BinPath = ""
+	p.Identifier = ""
+	p.Linux.BinPath = filepath.Join(p.OutDir, "missing")
+	p.MSI.BinPath = ""
+	p.Targets = []Target{
+		{OS: "darwin", Arch: "amd64"},
+		{OS: "linux", Arch: "amd64", Formats: []string{"appimage", "flatpak"}},
+		{OS: "windows", Arch: "amd64", Formats: []string{"msi"}},
+	}
+	jobs, err := p.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, j := range jobs {
+		got = append(got, j.Problems()...)
+	}
+	want := []string{
+		"darwin/amd64 pkg: Identifier is required",
+		`linux/amd64 appimage: binary "` + p.Linux.BinPath + `" not found`,
+		"linux/amd64 appimage: Linux.IconPath is required",
+		"linux/amd64 appimage: Linux.AppImageRuntimePath is required",
+		`linux/amd64 flatpak: binary "` + p.Linux.BinPath + `" not found`,
+		"linux/amd64 flatpak: Identifier is required",
+		"windows/amd64 msi: binary path is required",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems mismatch.\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// builders mkpkg doesn't provide bring their own binaries
+	j := Job{Target: Target{OS: "test"}, Builder: fakeBuilder{name: "fake"}}
+	if problems := j.Problems(); len(problems) != 0 {
+		t.Errorf("expected no problems for a custom builder, got: %v", problems)
+	}
+}
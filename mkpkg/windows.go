@@ -3,11 +3,13 @@ package mkpkg
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha1"
 	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -17,43 +19,168 @@ import (
 
 // MSIConfig configures an MSI Package
 type MSIConfig struct {
+	// Path to compatible windows binary executable to install
+	BinPath string
+	// toolchain used to build the MSI, one of: wix, wixl. wix runs the WiX
+	// toolset and only works on windows. wixl uses msitools, which run on
+	// linux. Default is wix on windows, and wixl elsewhere if it's installed
+	Backend string
+	// target architecture using go's GOARCH naming, one of: 386, amd64.
+	// Default is the architecture mkpkg is running on
+	Arch string
+	// publisher of the package, shown in Add/Remove Programs. Default is Name
+	Manufacturer string
+	// GUID that identifies the product across versions, eg:
+	// {22ea7650-4ac6-4001-bf29-f4b8775db1c0}. Changing this breaks upgrades.
+	// Default is derived from Identifier
+	UpgradeCode string
+	// name of the directory created under the system drive. Default is BinName
+	InstallDirName string
+	// start menu shortcuts to create. An uninstall shortcut is always added
+	Shortcuts []MSIShortcut
+	// environment variables to set. Default adds the install bin directory to
+	// the system PATH
+	Environment []MSIEnvVar
+	// support contact shown in Add/Remove Programs, eg: support@qri.io
+	ARPContact string
+	// help link shown in Add/Remove Programs, eg: https://qri.io/docs
+	ARPHelpLink string
+	// path to an .ico file to use as the product icon
+	IconPath string
+	// path to an .rtf license to show in the installer
+	LicenseRtfPath string
+	// path to a 493x58 image to use as the installer banner
+	BannerPath string
+	// path to a 493x312 image to use as the installer welcome dialog background
+	DialogPath string
+}
+
+// MSIShortcut is a start menu shortcut
+type MSIShortcut struct {
+	// shortcut display name
+	Name string
+	// shortcut tooltip
+	Description string
+	// file the shortcut launches. Default is the installed binary
+	Target string
+	// command line arguments passed to Target
+	Arguments string
+}
+
+// MSIEnvVar is an environment variable set by the installer. Values may
+// reference the install location as [INSTALLDIR]
+type MSIEnvVar struct {
+	// variable name, eg: PATH
+	Name string
+	// variable value, eg: [INSTALLDIR]bin
+	Value string
+	// one of: all, first, last. first & last append to existing values.
+	// Default is all
+	Part string
+	// set as a system variable instead of a user variable
+	System bool
+}
+
+// arch returns the configured GOARCH-style architecture, defaulting to the
+// architecture of the running process
+func (c MSIConfig) arch() string {
+	if c.Arch == "" {
+		return runtime.GOARCH
+	}
+	return c.Arch
+}
+
+// msArch returns the microsoft name for the configured architecture
+func (c MSIConfig) msArch() (string, error) {
+	switch c.arch() {
+	case "386":
+		return "x86", nil
+	case "amd64":
+		return "x64", nil
+	default:
+		return "", fmt.Errorf("unknown arch for windows: %s", c.arch())
+	}
+}
+
+// backend returns the MSI backend to use, detecting one if not configured
+func (c MSIConfig) backend() (string, error) {
+	switch c.Backend {
+	case "wix", "wixl":
+		return c.Backend, nil
+	case "":
+		if runtime.GOOS == "windows" {
+			return "wix", nil
+		}
+		if _, err := exec.LookPath("wixl"); err == nil {
+			return "wixl", nil
+		}
+		return "", fmt.Errorf("building an MSI off windows requires wixl. install msitools and try again")
+	default:
+		return "", fmt.Errorf("unknown MSI backend: %s", c.Backend)
+	}
 }
 
 const wixBinaries = "https://storage.googleapis.com/go-builder-data/wix311-binaries.zip"
 const wixSha256 = "da034c489bd1dd6d8e1623675bf5e899f32d74d6d8312f8dd125a084543193de"
 
-func (p Package) windowsMSI() error {
-	cwd, version, err := p.environ()
+func (p Package) windowsMSI() (string, error) {
+	backend, err := p.MSI.backend()
 	if err != nil {
-		return err
+		return "", err
+	}
+	if backend == "wixl" {
+		return p.wixlMSI()
+	}
+	return p.wixMSI()
+}
+
+func (p Package) wixMSI() (string, error) {
+	if runtime.GOOS != "windows" {
+		return "", fmt.Errorf("can only build windows installer msi with wix on windows")
+	}
+
+	outDir, version, err := p.environ()
+	if err != nil {
+		return "", err
 	}
 
-	panic("windows MSI not yet finished")
+	arch, err := p.MSI.msArch()
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := workDir("msi")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
 
 	// Install Wix tools.
-	wix := filepath.Join(cwd, "wix")
-	defer os.RemoveAll(wix)
+	wix := filepath.Join(tmp, "wix")
 	if err := installWix(wix); err != nil {
-		return err
+		return "", err
 	}
 
-	windowsData, err := p.windowsData()
+	windowsData, err := p.windowsData(installerWxsTmpl)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Write out windows data that is used by the packaging process.
-	win := filepath.Join(cwd, "windows")
-	defer os.RemoveAll(win)
+	win := filepath.Join(tmp, "windows")
 	if err := writeDataFiles(windowsData, win); err != nil {
-		return err
+		return "", err
+	}
+
+	appDir := filepath.Join(win, "app")
+	if err := p.stageWindowsApp(appDir, p.MSI.BinPath); err != nil {
+		return "", err
 	}
 
 	// Gather files.
-	goDir := filepath.Join(cwd, "go")
 	appfiles := filepath.Join(win, "AppFiles.wxs")
 	if err := runDir(win, filepath.Join(wix, "heat"),
-		"dir", goDir,
+		"dir", appDir,
 		"-nologo",
 		"-gg", "-g1", "-srd", "-sfrag",
 		"-cg", "AppFiles",
@@ -62,18 +189,7 @@ func (p Package) windowsMSI() error {
 		"-var", "var.SourceDir",
 		"-out", appfiles,
 	); err != nil {
-		return err
-	}
-
-	msArch := func() string {
-		switch runtime.GOARCH {
-		default:
-			panic("unknown arch for windows " + runtime.GOARCH)
-		case "386":
-			return "x86"
-		case "amd64":
-			return "x64"
-		}
+		return "", err
 	}
 
 	// Build package.
@@ -81,38 +197,52 @@ func (p Package) windowsMSI() error {
 
 	if err := runDir(win, filepath.Join(wix, "candle"),
 		"-nologo",
-		"-arch", msArch(),
-		"-dGoVersion="+version,
-		fmt.Sprintf("-dWixGoVersion=%v.%v.%v", verMajor, verMinor, verPatch),
-		fmt.Sprintf("-dIsWinXPSupported=%v", wixIsWinXPSupported(version)),
-		"-dArch="+runtime.GOARCH,
-		"-dSourceDir="+goDir,
+		"-arch", arch,
+		"-dVersion="+version,
+		fmt.Sprintf("-dWixVersion=%v.%v.%v", verMajor, verMinor, verPatch),
+		"-dArch="+p.MSI.arch(),
+		"-dSourceDir="+appDir,
 		filepath.Join(win, "installer.wxs"),
 		appfiles,
 	); err != nil {
-		return err
+		return "", err
 	}
 
-	msi := filepath.Join(cwd, "msi") // known to cmd/release
-	if err := os.Mkdir(msi, 0755); err != nil {
-		return err
-	}
-	return runDir(win, filepath.Join(wix, "light"),
+	out := filepath.Join(outDir, p.msiName())
+	if err := runDir(win, filepath.Join(wix, "light"),
 		"-nologo",
 		"-dcl:high",
 		"-ext", "WixUIExtension",
 		"-ext", "WixUtilExtension",
 		"AppFiles.wixobj",
 		"installer.wixobj",
-		"-o", filepath.Join(msi, "go.msi"), // file name irrelevant
-	)
+		"-o", out,
+	); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// stageWindowsApp places files in dir as they should be laid out in the
+// install directory, using the windows binary at binPath
+func (p Package) stageWindowsApp(dir, binPath string) error {
+	binDir := filepath.Join(dir, "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return err
+	}
+	return cp(filepath.Join(binDir, p.BinName+".exe"), binPath)
+}
+
+// msiName returns the file name of the msi, eg: qri-v0.5.0-windows-amd64.msi
+func (p Package) msiName() string {
+	return fmt.Sprintf("%s-%s-windows-%s.msi", p.BinName, p.Version, p.MSI.arch())
 }
 
 var versionRe = regexp.MustCompile(`^v(\d+(\.\d+)*)`)
 
-// wixVersion splits a Go version string such as "v1.9" or "v1.10.2" (as matched by versionRe)
-// into its three parts: major, minor, and patch
-// It's based on the Git tag.
+// wixVersion splits a package version string such as "v1.9" or "v1.10.2"
+// (as matched by versionRe) into its three parts: major, minor, and patch.
+// Missing parts are zero
 func wixVersion(v string) (major, minor, patch int) {
 	m := versionRe.FindStringSubmatch(v)
 	if m == nil {
@@ -133,20 +263,6 @@ func wixVersion(v string) (major, minor, patch int) {
 	return
 }
 
-// wixIsWinXPSupported checks if Windows XP
-// support is expected from the specified version.
-// (WinXP is no longer supported starting Go v1.11)
-func wixIsWinXPSupported(v string) bool {
-	major, minor, _ := wixVersion(v)
-	if major > 1 {
-		return false
-	}
-	if minor >= 11 {
-		return false
-	}
-	return true
-}
-
 // installWix fetches and installs the wix toolkit to the specified path.
 func installWix(path string) error {
 	// Fetch wix binary zip file.
@@ -190,80 +306,153 @@ func installWix(path string) error {
 	return nil
 }
 
-func (p Package) windowsData() (map[string]string, error) {
+// wxsData is the data used to render installer.wxs, with defaults applied
+type wxsData struct {
+	Package
+	Manufacturer   string
+	UpgradeCode    string
+	InstallDirName string
+	RegistryKey    string
+	Shortcuts      []MSIShortcut
+	Environment    []MSIEnvVar
+	ShortcutsGUID  string
+	EnvGUID        string
+}
+
+// wxsData applies defaults to MSI configuration details
+func (p Package) wxsData() wxsData {
+	d := wxsData{
+		Package:        p,
+		Manufacturer:   p.MSI.Manufacturer,
+		UpgradeCode:    p.MSI.UpgradeCode,
+		InstallDirName: p.MSI.InstallDirName,
+		Environment:    p.MSI.Environment,
+	}
+	if d.Manufacturer == "" {
+		d.Manufacturer = p.Name
+	}
+	if d.UpgradeCode == "" {
+		d.UpgradeCode = wixGUID(p.Identifier, "UpgradeCode")
+	}
+	if d.InstallDirName == "" {
+		d.InstallDirName = p.BinName
+	}
+	if d.Environment == nil {
+		d.Environment = []MSIEnvVar{
+			{Name: "PATH", Value: "[INSTALLDIR]bin", Part: "last", System: true},
+		}
+	}
+	for _, sc := range p.MSI.Shortcuts {
+		if sc.Target == "" {
+			sc.Target = fmt.Sprintf("[INSTALLDIR]bin\\%s.exe", p.BinName)
+		}
+		d.Shortcuts = append(d.Shortcuts, sc)
+	}
+	d.RegistryKey = fmt.Sprintf("Software\\%s", p.Name)
+	if p.MSI.Manufacturer != "" {
+		d.RegistryKey = fmt.Sprintf("Software\\%s\\%s", p.MSI.Manufacturer, p.Name)
+	}
+	d.ShortcutsGUID = wixGUID(d.UpgradeCode, "Shortcuts")
+	d.EnvGUID = wixGUID(d.UpgradeCode, "Environment")
+	return d
+}
+
+// wixGUID derives a stable GUID from a namespace and name, in the style of a
+// version 5 UUID. Component GUIDs must not change between releases, and
+// must differ between products
+func wixGUID(namespace, name string) string {
+	h := sha1.Sum([]byte(namespace + "/" + name))
+	h[6] = (h[6] & 0x0f) | 0x50
+	h[8] = (h[8] & 0x3f) | 0x80
+	return fmt.Sprintf("{%x-%x-%x-%x-%x}", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
 
-	installerWxs, err := p.execTemplate(installerWxsTmpl)
+// windowsData renders the installer.wxs template tmpl, and gathers assets it
+// references
+func (p Package) windowsData(tmpl string) (map[string]string, error) {
+	installerWxs, err := renderTemplate(tmpl, p.wxsData())
 	if err != nil {
 		return nil, err
 	}
 
-	return map[string]string{
-		"installer.wxs":         installerWxs,
-		"LICENSE.rtf":           storageBase + "windows/LICENSE.rtf",
-		"images/Banner.jpg":     storageBase + "windows/Banner.jpg",
-		"images/Dialog.jpg":     storageBase + "windows/Dialog.jpg",
-		"images/DialogLeft.jpg": storageBase + "windows/DialogLeft.jpg",
-		"images/gopher.ico":     storageBase + "windows/gopher.ico",
-	}, nil
+	data := map[string]string{
+		"installer.wxs": installerWxs,
+	}
+	assets := map[string]string{
+		"images/product.ico": p.MSI.IconPath,
+		"LICENSE.rtf":        p.MSI.LicenseRtfPath,
+		"images/Banner.jpg":  p.MSI.BannerPath,
+		"images/Dialog.jpg":  p.MSI.DialogPath,
+	}
+	for name, path := range assets {
+		if path == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data[name] = string(b)
+	}
+	return data, nil
 }
 
 var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
 <Wix xmlns="http://schemas.microsoft.com/wix/2006/wi">
 <!--
+# Based on the Go installer.
 # Copyright 2010 The Go Authors.  All rights reserved.
 # Use of this source code is governed by a BSD-style
 # license that can be found in the LICENSE file.
 -->
 
 <?if $(var.Arch) = 386 ?>
-  <?define ProdId = {FF5B30B2-08C2-11E1-85A2-6ACA4824019B} ?>
-  <?define UpgradeCode = {1C3114EA-08C3-11E1-9095-7FCA4824019B} ?>
   <?define SysFolder=SystemFolder ?>
 <?else?>
-  <?define ProdId = {716c3eaa-9302-48d2-8e5e-5cfec5da2fab} ?>
-  <?define UpgradeCode = {22ea7650-4ac6-4001-bf29-f4b8775db1c0} ?>
   <?define SysFolder=System64Folder ?>
 <?endif?>
 
 <Product
     Id="*"
-    Name="Go Programming Language $(var.Arch) $(var.GoVersion)"
+    Name="{{ .Name | html }} $(var.Arch) $(var.Version)"
     Language="1033"
-    Version="$(var.WixGoVersion)"
-    Manufacturer="https://golang.org"
-    UpgradeCode="$(var.UpgradeCode)" >
+    Version="$(var.WixVersion)"
+    Manufacturer="{{ .Manufacturer | html }}"
+    UpgradeCode="{{ .UpgradeCode }}" >
 
 <Package
     Id='*'
     Keywords='Installer'
-    Description="The Go Programming Language Installer"
-    Comments="The Go programming language is an open source project to make programmers more productive."
+    Description="{{ .Name | html }} Installer"
+    Comments="{{ .Description | html }}"
     InstallerVersion="300"
     Compressed="yes"
     InstallScope="perMachine"
     Languages="1033" />
 
-<Property Id="ARPCOMMENTS" Value="The Go programming language is a fast, statically typed, compiled language that feels like a dynamically typed, interpreted language." />
-<Property Id="ARPCONTACT" Value="golang-nuts@googlegroups.com" />
-<Property Id="ARPHELPLINK" Value="https://golang.org/help/" />
-<Property Id="ARPREADME" Value="https://golang.org" />
-<Property Id="ARPURLINFOABOUT" Value="https://golang.org" />
+<Property Id="ARPCOMMENTS" Value="{{ .Description | html }}" />
+{{- if .MSI.ARPContact }}
+<Property Id="ARPCONTACT" Value="{{ .MSI.ARPContact | html }}" />
+{{- end }}
+{{- if .MSI.ARPHelpLink }}
+<Property Id="ARPHELPLINK" Value="{{ .MSI.ARPHelpLink | html }}" />
+{{- end }}
+{{- if .SiteURL }}
+<Property Id="ARPREADME" Value="{{ .SiteURL | html }}" />
+<Property Id="ARPURLINFOABOUT" Value="{{ .SiteURL | html }}" />
+{{- end }}
 <Property Id="LicenseAccepted">1</Property>
-<Icon Id="gopher.ico" SourceFile="images\gopher.ico"/>
-<Property Id="ARPPRODUCTICON" Value="gopher.ico" />
-<Property Id="EXISTING_GOLANG_INSTALLED">
-  <RegistrySearch Id="installed" Type="raw" Root="HKCU" Key="Software\GoProgrammingLanguage" Name="installed" />
+{{- if .MSI.IconPath }}
+<Icon Id="product.ico" SourceFile="images\product.ico"/>
+<Property Id="ARPPRODUCTICON" Value="product.ico" />
+{{- end }}
+<Property Id="EXISTING_INSTALLED">
+  <RegistrySearch Id="installed" Type="raw" Root="HKCU" Key="{{ .RegistryKey | html }}" Name="installed" />
 </Property>
-<Media Id='1' Cabinet="go.cab" EmbedCab="yes" CompressionLevel="high" />
-<?if $(var.IsWinXPSupported) = true ?>
-    <Condition Message="Windows XP (with Service Pack 2) or greater required.">
-        (VersionNT >= 501 AND (WindowsBuild > 2600 OR ServicePackLevel >= 2))
-    </Condition>
-<?else?>
-    <Condition Message="Windows 7 (with Service Pack 1) or greater required.">
-        ((VersionNT > 601) OR (VersionNT = 601 AND ServicePackLevel >= 1))
-    </Condition>
-<?endif?>
+<Media Id='1' Cabinet="{{ .BinName }}.cab" EmbedCab="yes" CompressionLevel="high" />
+<Condition Message="Windows 7 (with Service Pack 1) or greater required.">
+    ((VersionNT > 601) OR (VersionNT = 601 AND ServicePackLevel >= 1))
+</Condition>
 <MajorUpgrade AllowDowngrades="yes" />
 <SetDirectory Id="INSTALLDIRROOT" Value="[%SYSTEMDRIVE]"/>
 
@@ -275,39 +464,44 @@ var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
 <!-- Define the directory structure and environment variables -->
 <Directory Id="TARGETDIR" Name="SourceDir">
   <Directory Id="INSTALLDIRROOT">
-    <Directory Id="INSTALLDIR" Name="Go"/>
+    <Directory Id="INSTALLDIR" Name="{{ .InstallDirName | html }}"/>
   </Directory>
   <Directory Id="ProgramMenuFolder">
-    <Directory Id="GoProgramShortcutsDir" Name="Go Programming Language"/>
+    <Directory Id="ProgramShortcutsDir" Name="{{ .Name | html }}"/>
   </Directory>
   <Directory Id="EnvironmentEntries">
-    <Directory Id="GoEnvironmentEntries" Name="Go Programming Language"/>
+    <Directory Id="ProgramEnvironmentEntries" Name="{{ .Name | html }}"/>
   </Directory>
 </Directory>
 
 <!-- Programs Menu Shortcuts -->
-<DirectoryRef Id="GoProgramShortcutsDir">
-  <Component Id="Component_GoProgramShortCuts" Guid="{f5fbfb5e-6c5c-423b-9298-21b0e3c98f4b}">
+<DirectoryRef Id="ProgramShortcutsDir">
+  <Component Id="Component_ProgramShortCuts" Guid="{{ .ShortcutsGUID }}">
+{{- range $i, $sc := .Shortcuts }}
     <Shortcut
-        Id="GoDocServerStartMenuShortcut"
-        Name="GoDocServer"
-        Description="Starts the Go documentation server (http://localhost:6060)"
-        Show="minimized"
-        Arguments='/c start "Godoc Server http://localhost:6060" "[INSTALLDIR]bin\godoc.exe" -http=localhost:6060 -goroot="[INSTALLDIR]." &amp;&amp; start http://localhost:6060'
-        Icon="gopher.ico"
-        Target="[%ComSpec]" />
+        Id="StartMenuShortcut{{ $i }}"
+        Name="{{ $sc.Name | html }}"
+        Description="{{ $sc.Description | html }}"
+        {{- if $sc.Arguments }}
+        Arguments="{{ $sc.Arguments | html }}"
+        {{- end }}
+        {{- if $.MSI.IconPath }}
+        Icon="product.ico"
+        {{- end }}
+        Target="{{ $sc.Target | html }}" />
+{{- end }}
     <Shortcut
         Id="UninstallShortcut"
-        Name="Uninstall Go"
-        Description="Uninstalls Go and all of its components"
+        Name="Uninstall {{ .Name | html }}"
+        Description="Uninstalls {{ .Name | html }} and all of its components"
         Target="[$(var.SysFolder)]msiexec.exe"
         Arguments="/x [ProductCode]" />
     <RemoveFolder
-        Id="GoProgramShortcutsDir"
+        Id="ProgramShortcutsDir"
         On="uninstall" />
     <RegistryValue
         Root="HKCU"
-        Key="Software\GoProgrammingLanguage"
+        Key="{{ .RegistryKey | html }}"
         Name="ShortCuts"
         Type="integer"
         Value="1"
@@ -316,11 +510,11 @@ var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
 </DirectoryRef>
 
 <!-- Registry & Environment Settings -->
-<DirectoryRef Id="GoEnvironmentEntries">
-  <Component Id="Component_GoEnvironment" Guid="{3ec7a4d5-eb08-4de7-9312-2df392c45993}">
+<DirectoryRef Id="ProgramEnvironmentEntries">
+  <Component Id="Component_Environment" Guid="{{ .EnvGUID }}">
     <RegistryKey
         Root="HKCU"
-        Key="Software\GoProgrammingLanguage">
+        Key="{{ .RegistryKey | html }}">
             <RegistryValue
                 Name="installed"
                 Type="integer"
@@ -331,49 +525,30 @@ var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
                 Type="string"
                 Value="[INSTALLDIR]" />
     </RegistryKey>
+{{- range $i, $env := .Environment }}
     <Environment
-        Id="GoPathEntry"
+        Id="EnvironmentEntry{{ $i }}"
         Action="set"
-        Part="last"
-        Name="PATH"
+        Part="{{ if $env.Part }}{{ $env.Part }}{{ else }}all{{ end }}"
+        Name="{{ $env.Name | html }}"
         Permanent="no"
-        System="yes"
-        Value="[INSTALLDIR]bin" />
-    <Environment
-        Id="GoRoot"
-        Action="set"
-        Part="all"
-        Name="GOROOT"
-        Permanent="no"
-        System="yes"
-        Value="[INSTALLDIR]" />
-    <Environment
-        Id="UserGoPath"
-        Action="create"
-        Name="GOPATH"
-        Permanent="no"
-        Value="%USERPROFILE%\go" />
-    <Environment
-        Id="UserGoPathEntry"
-        Action="set"
-        Part="last"
-        Name="PATH"
-        Permanent="no"
-        Value="%GOPATH%\bin" />
+        System="{{ if $env.System }}yes{{ else }}no{{ end }}"
+        Value="{{ $env.Value | html }}" />
+{{- end }}
     <RemoveFolder
-        Id="GoEnvironmentEntries"
+        Id="ProgramEnvironmentEntries"
         On="uninstall" />
   </Component>
 </DirectoryRef>
 
 <!-- Install the files -->
 <Feature
-    Id="GoTools"
-    Title="Go"
+    Id="ProductFeature"
+    Title="{{ .Name | html }}"
     Level="1">
-      <ComponentRef Id="Component_GoEnvironment" />
+      <ComponentRef Id="Component_Environment" />
       <ComponentGroupRef Id="AppFiles" />
-      <ComponentRef Id="Component_GoProgramShortCuts" />
+      <ComponentRef Id="Component_ProgramShortCuts" />
 </Feature>
 
 <!-- Update the environment -->
@@ -385,22 +560,29 @@ var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
 <CustomActionRef Id="WixBroadcastEnvironmentChange" />
 
 <!-- Include the user interface -->
+{{- if .MSI.LicenseRtfPath }}
 <WixVariable Id="WixUILicenseRtf" Value="LICENSE.rtf" />
+{{- end }}
+{{- if .MSI.BannerPath }}
 <WixVariable Id="WixUIBannerBmp" Value="images\Banner.jpg" />
+{{- end }}
+{{- if .MSI.DialogPath }}
 <WixVariable Id="WixUIDialogBmp" Value="images\Dialog.jpg" />
+{{- end }}
 <Property Id="WIXUI_INSTALLDIR" Value="INSTALLDIR" />
-<UIRef Id="Golang_InstallDir" />
+<UIRef Id="Product_InstallDir" />
 <UIRef Id="WixUI_ErrorProgressText" />
 
 </Product>
 <Fragment>
   <!--
-    The installer steps are modified so we can get user confirmation to uninstall an existing golang installation.
+    The installer steps are modified so we can get user confirmation to uninstall an existing installation.
+    LicenseAgreementDlg is only shown when a license is configured.
 
-    WelcomeDlg  [not installed]  =>                  LicenseAgreementDlg => InstallDirDlg  ..
-                [installed]      => OldVersionDlg => LicenseAgreementDlg => InstallDirDlg  ..
+    WelcomeDlg  [not installed]  =>                  [LicenseAgreementDlg =>] InstallDirDlg  ..
+                [installed]      => OldVersionDlg => [LicenseAgreementDlg =>] InstallDirDlg  ..
   -->
-  <UI Id="Golang_InstallDir">
+  <UI Id="Product_InstallDir">
     <!-- style -->
     <TextStyle Id="WixUI_Font_Normal" FaceName="Tahoma" Size="8" />
     <TextStyle Id="WixUI_Font_Bigger" FaceName="Tahoma" Size="12" />
@@ -422,7 +604,7 @@ var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
     <DialogRef Id="UserExit" />
     <Dialog Id="OldVersionDlg" Width="240" Height="95" Title="[ProductName] Setup" NoMinimize="yes">
       <Control Id="Text" Type="Text" X="28" Y="15" Width="194" Height="50">
-        <Text>A previous version of Go Programming Language is currently installed. By continuing the installation this version will be uninstalled. Do you want to continue?</Text>
+        <Text>A previous version of {{ .Name | html }} is currently installed. By continuing the installation this version will be uninstalled. Do you want to continue?</Text>
       </Control>
       <Control Id="Exit" Type="PushButton" X="123" Y="67" Width="62" Height="17"
         Default="yes" Cancel="yes" Text="No, Exit">
@@ -439,8 +621,9 @@ var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
 
     <Publish Dialog="ExitDialog" Control="Finish" Event="EndDialog" Value="Return" Order="999">1</Publish>
 
-    <Publish Dialog="WelcomeDlg" Control="Next" Event="NewDialog" Value="OldVersionDlg"><![CDATA[EXISTING_GOLANG_INSTALLED << "#1"]]> </Publish>
-    <Publish Dialog="WelcomeDlg" Control="Next" Event="NewDialog" Value="LicenseAgreementDlg"><![CDATA[NOT (EXISTING_GOLANG_INSTALLED << "#1")]]></Publish>
+{{- if .MSI.LicenseRtfPath }}
+    <Publish Dialog="WelcomeDlg" Control="Next" Event="NewDialog" Value="OldVersionDlg"><![CDATA[EXISTING_INSTALLED << "#1"]]> </Publish>
+    <Publish Dialog="WelcomeDlg" Control="Next" Event="NewDialog" Value="LicenseAgreementDlg"><![CDATA[NOT (EXISTING_INSTALLED << "#1")]]></Publish>
 
     <Publish Dialog="OldVersionDlg" Control="Next" Event="NewDialog" Value="LicenseAgreementDlg">1</Publish>
 
@@ -448,6 +631,14 @@ var installerWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
     <Publish Dialog="LicenseAgreementDlg" Control="Next" Event="NewDialog" Value="InstallDirDlg">LicenseAccepted = "1"</Publish>
 
     <Publish Dialog="InstallDirDlg" Control="Back" Event="NewDialog" Value="LicenseAgreementDlg">1</Publish>
+{{- else }}
+    <Publish Dialog="WelcomeDlg" Control="Next" Event="NewDialog" Value="OldVersionDlg"><![CDATA[EXISTING_INSTALLED << "#1"]]> </Publish>
+    <Publish Dialog="WelcomeDlg" Control="Next" Event="NewDialog" Value="InstallDirDlg"><![CDATA[NOT (EXISTING_INSTALLED << "#1")]]></Publish>
+
+    <Publish Dialog="OldVersionDlg" Control="Next" Event="NewDialog" Value="InstallDirDlg">1</Publish>
+
+    <Publish Dialog="InstallDirDlg" Control="Back" Event="NewDialog" Value="WelcomeDlg">1</Publish>
+{{- end }}
     <Publish Dialog="InstallDirDlg" Control="Next" Event="SetTargetPath" Value="[WIXUI_INSTALLDIR]" Order="1">1</Publish>
     <Publish Dialog="InstallDirDlg" Control="Next" Event="DoAction" Value="WixUIValidatePath" Order="2">NOT WIXUI_DONTVALIDATEPATH</Publish>
     <Publish Dialog="InstallDirDlg" Control="Next" Event="SpawnDialog" Value="InvalidDirDlg" Order="3"><![CDATA[NOT WIXUI_DONTVALIDATEPATH AND WIXUI_INSTALLDIR_VALID<>"1"]]></Publish>
@@ -0,0 +1,127 @@
+package mkpkg
+
+import (
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// checkXML fails the test if doc isn't well formed XML
+func checkXML(t *testing.T, name, doc string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(doc))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("%s isn't valid XML: %s\n%s", name, err, doc)
+		}
+	}
+}
+
+func TestWindowsDataLicenseDialog(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Name = "Qri & Friends"
+
+	data, err := p.windowsData(installerWxsTmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wxs := data["installer.wxs"]
+	checkXML(t, "installer.wxs", wxs)
+	if strings.Contains(wxs, `Value="LicenseAgreementDlg"`) {
+		t.Errorf("installer without a license shows the license dialog")
+	}
+	if !strings.Contains(wxs, `<Publish Dialog="InstallDirDlg" Control="Back" Event="NewDialog" Value="WelcomeDlg">`) {
+		t.Errorf("install dir dialog doesn't lead back to the welcome dialog")
+	}
+	if _, ok := data["LICENSE.rtf"]; ok {
+		t.Errorf("unexpected LICENSE.rtf asset")
+	}
+
+	p.MSI.LicenseRtfPath = filepath.Join(filepath.Dir(p.LicensePath), "LICENSE")
+	data, err = p.windowsData(installerWxsTmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wxs = data["installer.wxs"]
+	checkXML(t, "installer.wxs", wxs)
+	for _, s := range []string{
+		`<WixVariable Id="WixUILicenseRtf" Value="LICENSE.rtf" />`,
+		`<Publish Dialog="OldVersionDlg" Control="Next" Event="NewDialog" Value="LicenseAgreementDlg">`,
+	} {
+		if !strings.Contains(wxs, s) {
+			t.Errorf("licensed installer missing %s", s)
+		}
+	}
+	if data["LICENSE.rtf"] == "" {
+		t.Errorf("expected LICENSE.rtf asset")
+	}
+}
+
+func TestWixVersion(t *testing.T) {
+	cases := []struct {
+		in                  string
+		major, minor, patch int
+	}{
+		{"v1.9", 1, 9, 0},
+		{"v1.10.2", 1, 10, 2},
+		{"v0.5.0-rc1", 0, 5, 0},
+		{"1.2.3", 0, 0, 0},
+	}
+	for _, c := range cases {
+		major, minor, patch := wixVersion(c.in)
+		if major != c.major || minor != c.minor || patch != c.patch {
+			t.Errorf("%s: got %d.%d.%d, want %d.%d.%d", c.in, major, minor, patch, c.major, c.minor, c.patch)
+		}
+	}
+}
+
+func TestWixGUID(t *testing.T) {
+	a := wixGUID("io.qri.cli", "UpgradeCode")
+	if a != wixGUID("io.qri.cli", "UpgradeCode") {
+		t.Errorf("GUIDs aren't stable")
+	}
+	if a == wixGUID("io.qri.cli", "Shortcuts") {
+		t.Errorf("GUIDs don't vary by name")
+	}
+	if len(a) != 38 || a[15] != '5' {
+		t.Errorf("malformed version 5 GUID: %s", a)
+	}
+}
+
+func TestWxsDataDefaults(t *testing.T) {
+	p := Package{Name: "Qri", BinName: "qri", Identifier: "io.qri.cli"}
+	p.MSI.Shortcuts = []MSIShortcut{{Name: "Qri Shell"}}
+	d := p.wxsData()
+	if d.Manufacturer != "Qri" || d.InstallDirName != "qri" || d.RegistryKey != `Software\Qri` {
+		t.Errorf("defaults mismatch: %q %q %q", d.Manufacturer, d.InstallDirName, d.RegistryKey)
+	}
+	if d.UpgradeCode != wixGUID("io.qri.cli", "UpgradeCode") {
+		t.Errorf("upgrade code isn't derived from Identifier: %s", d.UpgradeCode)
+	}
+	if len(d.Environment) != 1 || d.Environment[0].Value != "[INSTALLDIR]bin" {
+		t.Errorf("expected default PATH entry, got: %#v", d.Environment)
+	}
+	if d.Shortcuts[0].Target != `[INSTALLDIR]bin\qri.exe` {
+		t.Errorf("shortcut target mismatch: %s", d.Shortcuts[0].Target)
+	}
+
+	p.MSI.Manufacturer = "Qri, Inc."
+	p.MSI.Environment = []MSIEnvVar{}
+	d = p.wxsData()
+	if d.RegistryKey != `Software\Qri, Inc.\Qri` {
+		t.Errorf("registry key mismatch: %s", d.RegistryKey)
+	}
+	if len(d.Environment) != 0 {
+		t.Errorf("an empty Environment should disable the PATH entry")
+	}
+	if d.ShortcutsGUID == d.EnvGUID {
+		t.Errorf("component GUIDs must differ")
+	}
+}
@@ -0,0 +1,463 @@
+package mkpkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// WindowsManifestsConfig encapsulates configuration details for generating
+// winget & chocolatey manifests for windows MSIs, and scoop manifests for
+// portable zips
+type WindowsManifestsConfig struct {
+	// template for the url packages are published at. Templates have access
+	// to all Package fields, and File, the package file name, eg:
+	// https://github.com/qri-io/qri/releases/download/{{ .Version }}/{{ .File }}
+	URL string
+	// publisher of the package. Default is MSI.Manufacturer, falling back
+	// to Name
+	Publisher string
+	// winget package identifier in Publisher.Package form, eg: Qri.Qri.
+	// Default is derived from Publisher & BinName
+	WingetID string
+	// chocolatey package tags. Default is [BinName]
+	Tags []string
+}
+
+// wingetManifestVersion is the version of the winget manifest schema
+const wingetManifestVersion = "1.6.0"
+
+// windowsArtifacts returns the published windows packages of format
+func (p Package) windowsArtifacts(artifacts []Artifact, format string) ([]publishedArtifact, error) {
+	if p.WindowsManifests.URL == "" {
+		return nil, fmt.Errorf("WindowsManifests.URL is required")
+	}
+	return p.publishedArtifacts(p.WindowsManifests.URL, artifacts, "windows", format)
+}
+
+// publisher returns the configured publisher, defaulting to the MSI
+// manufacturer, then Name
+func (p Package) publisher() string {
+	if p.WindowsManifests.Publisher != "" {
+		return p.WindowsManifests.Publisher
+	}
+	return p.wxsData().Manufacturer
+}
+
+// scoopManifest is a scoop app manifest
+type scoopManifest struct {
+	Version      string                       `json:"version"`
+	Description  string                       `json:"description"`
+	Homepage     string                       `json:"homepage,omitempty"`
+	License      string                       `json:"license"`
+	Architecture map[string]scoopArchitecture `json:"architecture"`
+	Bin          string                       `json:"bin"`
+}
+
+type scoopArchitecture struct {
+	URL        string `json:"url"`
+	Hash       string `json:"hash"`
+	ExtractDir string `json:"extract_dir"`
+}
+
+// scoopArchs maps GOARCH values to scoop architectures
+var scoopArchs = map[string]string{
+	"386":   "32bit",
+	"amd64": "64bit",
+	"arm64": "arm64",
+}
+
+// windowsScoop writes a scoop manifest for the portable zips in artifacts.
+// scoop extracts archives rather than running installers, and the zip's
+// layout is the same whichever MSI backend is in use
+func (p Package) windowsScoop(artifacts []Artifact) error {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return err
+	}
+	published, err := p.windowsArtifacts(artifacts, "zip")
+	if err != nil {
+		return err
+	}
+
+	archs := map[string]scoopArchitecture{}
+	for _, a := range published {
+		arch, ok := scoopArchs[a.Arch]
+		if !ok {
+			return fmt.Errorf("unsupported scoop architecture: %s", a.Arch)
+		}
+		// zips hold a single directory named for the zip
+		archs[arch] = scoopArchitecture{URL: a.URL, Hash: a.SHA256, ExtractDir: strings.TrimSuffix(filepath.Base(a.Path), ".zip")}
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(scoopManifest{
+		Version:      p.pkgVersion(),
+		Description:  p.summary(),
+		Homepage:     p.SiteURL,
+		License:      p.license(),
+		Architecture: archs,
+		Bin:          p.BinName + ext("windows"),
+	}); err != nil {
+		return err
+	}
+
+	return writeDataFiles(map[string]string{
+		p.BinName + ".json": buf.String(),
+	}, filepath.Join(outDir, "scoop"))
+}
+
+// winget manifests are split across version, installer & default locale files
+type wingetVersion struct {
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	DefaultLocale     string `yaml:"DefaultLocale"`
+	ManifestType      string `yaml:"ManifestType"`
+	ManifestVersion   string `yaml:"ManifestVersion"`
+}
+
+type wingetInstallers struct {
+	PackageIdentifier string            `yaml:"PackageIdentifier"`
+	PackageVersion    string            `yaml:"PackageVersion"`
+	Installers        []wingetInstaller `yaml:"Installers"`
+	ManifestType      string            `yaml:"ManifestType"`
+	ManifestVersion   string            `yaml:"ManifestVersion"`
+}
+
+type wingetInstaller struct {
+	Architecture    string `yaml:"Architecture"`
+	InstallerType   string `yaml:"InstallerType"`
+	InstallerURL    string `yaml:"InstallerUrl"`
+	InstallerSha256 string `yaml:"InstallerSha256"`
+	UpgradeBehavior string `yaml:"UpgradeBehavior"`
+}
+
+type wingetLocale struct {
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	PackageLocale     string `yaml:"PackageLocale"`
+	Publisher         string `yaml:"Publisher"`
+	PackageName       string `yaml:"PackageName"`
+	PackageURL        string `yaml:"PackageUrl,omitempty"`
+	License           string `yaml:"License"`
+	ShortDescription  string `yaml:"ShortDescription"`
+	Description       string `yaml:"Description,omitempty"`
+	Moniker           string `yaml:"Moniker"`
+	ManifestType      string `yaml:"ManifestType"`
+	ManifestVersion   string `yaml:"ManifestVersion"`
+}
+
+// wingetID returns the configured winget identifier, defaulting to
+// [Publisher].[BinName] with spaces & punctuation removed. It returns an
+// error if the identifier isn't in Publisher.Package form
+func (p Package) wingetID() (string, error) {
+	id := p.WindowsManifests.WingetID
+	if id == "" {
+		clean := func(s string) string {
+			return strings.Map(func(r rune) rune {
+				if r == ' ' || r == ',' || r == '.' {
+					return -1
+				}
+				return r
+			}, s)
+		}
+		id = clean(p.publisher()) + "." + clean(p.BinName)
+	}
+	parts := strings.Split(id, ".")
+	valid := len(parts) > 1
+	for _, part := range parts {
+		valid = valid && part != ""
+	}
+	if !valid {
+		return "", fmt.Errorf("winget identifier %q must be in Publisher.Package form, set WindowsManifests.WingetID", id)
+	}
+	return id, nil
+}
+
+// wingetArchs maps GOARCH values to winget installer architectures
+var wingetArchs = map[string]string{
+	"386":   "x86",
+	"amd64": "x64",
+	"arm64": "arm64",
+}
+
+// windowsWinget writes a multi-file winget manifest for the MSIs in
+// artifacts, laid out as in the winget-pkgs repository
+func (p Package) windowsWinget(artifacts []Artifact) error {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return err
+	}
+	published, err := p.windowsArtifacts(artifacts, "msi")
+	if err != nil {
+		return err
+	}
+	var installers []wingetInstaller
+	for _, a := range published {
+		arch, ok := wingetArchs[a.Arch]
+		if !ok {
+			return fmt.Errorf("unsupported winget architecture: %s", a.Arch)
+		}
+		installers = append(installers, wingetInstaller{
+			Architecture:    arch,
+			InstallerType:   "wix",
+			InstallerURL:    a.URL,
+			InstallerSha256: strings.ToUpper(a.SHA256),
+			UpgradeBehavior: "install",
+		})
+	}
+
+	id, err := p.wingetID()
+	if err != nil {
+		return err
+	}
+	version := p.pkgVersion()
+	docs := map[string]interface{}{
+		id + ".yaml": wingetVersion{
+			PackageIdentifier: id,
+			PackageVersion:    version,
+			DefaultLocale:     "en-US",
+			ManifestType:      "version",
+			ManifestVersion:   wingetManifestVersion,
+		},
+		id + ".installer.yaml": wingetInstallers{
+			PackageIdentifier: id,
+			PackageVersion:    version,
+			Installers:        installers,
+			ManifestType:      "installer",
+			ManifestVersion:   wingetManifestVersion,
+		},
+		id + ".locale.en-US.yaml": wingetLocale{
+			PackageIdentifier: id,
+			PackageVersion:    version,
+			PackageLocale:     "en-US",
+			Publisher:         p.publisher(),
+			PackageName:       p.Name,
+			PackageURL:        p.SiteURL,
+			License:           p.license(),
+			ShortDescription:  p.summary(),
+			Description:       strings.TrimSpace(p.Description),
+			Moniker:           p.BinName,
+			ManifestType:      "defaultLocale",
+			ManifestVersion:   wingetManifestVersion,
+		},
+	}
+
+	data := map[string]string{}
+	for name, doc := range docs {
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		data[name] = string(b)
+	}
+
+	// manifests/[first letter]/[publisher]/[package]/[version]
+	dir := filepath.Join(append([]string{outDir, "winget", "manifests", strings.ToLower(id[:1])}, append(strings.Split(id, "."), version)...)...)
+	return writeDataFiles(data, dir)
+}
+
+// nuspec is a chocolatey package specification
+type nuspec struct {
+	XMLName  xml.Name       `xml:"http://schemas.microsoft.com/packaging/2015/06/nuspec.xsd package"`
+	Metadata nuspecMetadata `xml:"metadata"`
+}
+
+type nuspecMetadata struct {
+	ID                       string `xml:"id"`
+	Version                  string `xml:"version"`
+	Title                    string `xml:"title"`
+	Authors                  string `xml:"authors"`
+	ProjectURL               string `xml:"projectUrl,omitempty"`
+	RequireLicenseAcceptance bool   `xml:"requireLicenseAcceptance"`
+	Tags                     string `xml:"tags"`
+	Summary                  string `xml:"summary"`
+	Description              string `xml:"description"`
+}
+
+// chocolateyInstaller is the url & checksum of an MSI in the install
+// script. Suffix selects the architecture
+type chocolateyInstaller struct {
+	Suffix, URL, Sum string
+}
+
+// chocolateySuffixes maps GOARCH values to chocolatey's install argument
+// suffixes
+var chocolateySuffixes = map[string]string{
+	"386":   "",
+	"amd64": "64",
+}
+
+// windowsChocolatey writes a chocolatey .nuspec & install script that
+// downloads the MSIs in artifacts, and packs them into a .nupkg
+func (p Package) windowsChocolatey(artifacts []Artifact) error {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return err
+	}
+	published, err := p.windowsArtifacts(artifacts, "msi")
+	if err != nil {
+		return err
+	}
+	// values are pre-quoted as powershell strings
+	var installers []chocolateyInstaller
+	for _, a := range published {
+		suffix, ok := chocolateySuffixes[a.Arch]
+		if !ok {
+			return fmt.Errorf("unsupported chocolatey architecture: %s", a.Arch)
+		}
+		installers = append(installers, chocolateyInstaller{Suffix: suffix, URL: psString(a.URL), Sum: psString(a.SHA256)})
+	}
+
+	tags := p.WindowsManifests.Tags
+	if len(tags) == 0 {
+		tags = []string{p.BinName}
+	}
+	desc := strings.TrimSpace(p.Description)
+	if desc == "" {
+		desc = p.Name
+	}
+	id := strings.ToLower(p.BinName)
+	spec := nuspec{Metadata: nuspecMetadata{
+		ID:          id,
+		Version:     p.pkgVersion(),
+		Title:       p.Name,
+		Authors:     p.publisher(),
+		ProjectURL:  p.SiteURL,
+		Tags:        strings.Join(tags, " "),
+		Summary:     p.summary(),
+		Description: desc,
+	}}
+	specXML, err := xml.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	install, err := renderTemplate(chocolateyInstallTmpl, installers)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		id + ".nuspec":                xml.Header + string(specXML) + "\n",
+		"tools/chocolateyinstall.ps1": install,
+	}
+	if err := writeDataFiles(files, filepath.Join(outDir, "chocolatey")); err != nil {
+		return err
+	}
+
+	nupkg, err := p.nupkg(spec, files)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outDir, fmt.Sprintf("%s.%s.nupkg", id, spec.Metadata.Version)), nupkg, 0644)
+}
+
+// nupkg packs files into a nuget package, an open packaging conventions zip
+// that also describes its own content types & metadata
+func (p Package) nupkg(spec nuspec, files map[string]string) ([]byte, error) {
+	id := spec.Metadata.ID
+	props := wixGUID(id+"/"+spec.Metadata.Version, "psmdcp")
+	props = strings.ToLower(strings.Trim(strings.Replace(props, "-", "", -1), "{}"))
+	propsPath := fmt.Sprintf("package/services/metadata/core-properties/%s.psmdcp", props)
+
+	all := map[string]string{
+		"[Content_Types].xml": nupkgContentTypes,
+		"_rels/.rels":         fmt.Sprintf(nupkgRels, xmlEscape(id+".nuspec"), propsPath),
+		propsPath: fmt.Sprintf(nupkgCoreProperties,
+			xmlEscape(spec.Metadata.Authors), xmlEscape(spec.Metadata.Description), xmlEscape(id),
+			xmlEscape(spec.Metadata.Version), xmlEscape(spec.Metadata.Tags), xmlEscape(spec.Metadata.Title)),
+	}
+	for name, body := range files {
+		all[name] = body
+	}
+
+	// the nuspec leads the archive
+	names := []string{id + ".nuspec"}
+	for name := range all {
+		if name != names[0] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	now := time.Now()
+	for _, name := range names {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(all[name])); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// psString quotes s as a single-quoted powershell string
+func psString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// chocolateyInstallTmpl downloads & silently installs the MSI for the host
+// architecture
+const chocolateyInstallTmpl = `$ErrorActionPreference = 'Stop'
+
+$packageArgs = @{
+  packageName = $env:ChocolateyPackageName
+  fileType = 'msi'
+{{- range . }}
+  url{{ .Suffix }} = {{ .URL }}
+  checksum{{ .Suffix }} = {{ .Sum }}
+  checksumType{{ .Suffix }} = 'sha256'
+{{- end }}
+  silentArgs = '/qn /norestart'
+  validExitCodes = @(0, 3010, 1641)
+}
+
+Install-ChocolateyPackage @packageArgs
+`
+
+const nupkgContentTypes = `<?xml version="1.0" encoding="utf-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+  <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml" />
+  <Default Extension="nuspec" ContentType="application/octet" />
+  <Default Extension="ps1" ContentType="application/octet" />
+  <Default Extension="psmdcp" ContentType="application/vnd.openxmlformats-package.core-properties+xml" />
+</Types>
+`
+
+const nupkgRels = `<?xml version="1.0" encoding="utf-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Type="http://schemas.microsoft.com/packaging/2010/07/manifest" Target="/%s" Id="R1" />
+  <Relationship Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="/%s" Id="R2" />
+</Relationships>
+`
+
+const nupkgCoreProperties = `<?xml version="1.0" encoding="utf-8"?>
+<coreProperties xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns="http://schemas.openxmlformats.org/package/2006/metadata/core-properties">
+  <dc:creator>%s</dc:creator>
+  <dc:description>%s</dc:description>
+  <dc:identifier>%s</dc:identifier>
+  <version>%s</version>
+  <keywords>%s</keywords>
+  <dc:title>%s</dc:title>
+  <lastModifiedBy>mkpkg</lastModifiedBy>
+</coreProperties>
+`
@@ -0,0 +1,245 @@
+package mkpkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestWindowsScoop(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.WindowsManifests.URL = "https://example.com/{{ .Version }}/{{ .File }}"
+	amd64 := writeTestArtifact(t, p, "qri-v0.5.0-windows-amd64.zip", "windows", "zip", "amd64")
+	x86 := writeTestArtifact(t, p, "qri-v0.5.0-windows-386.zip", "windows", "zip", "386")
+	msi := writeTestArtifact(t, p, p.msiName(), "windows", "msi", "amd64")
+
+	if err := p.windowsScoop([]Artifact{amd64, x86, msi}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p.OutDir, "scoop", "qri.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m scoopManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	want := scoopManifest{
+		Version:     "0.5.0",
+		Description: "qri is a web of datasets second paragraph",
+		Homepage:    "https://qri.io",
+		License:     "GPL-3.0",
+		Architecture: map[string]scoopArchitecture{
+			"64bit": {URL: "https://example.com/v0.5.0/qri-v0.5.0-windows-amd64.zip", Hash: amd64.SHA256, ExtractDir: "qri-v0.5.0-windows-amd64"},
+			"32bit": {URL: "https://example.com/v0.5.0/qri-v0.5.0-windows-386.zip", Hash: x86.SHA256, ExtractDir: "qri-v0.5.0-windows-386"},
+		},
+		Bin: "qri.exe",
+	}
+	got, _ := json.Marshal(m)
+	exp, _ := json.Marshal(want)
+	if !bytes.Equal(got, exp) {
+		t.Errorf("scoop manifest mismatch.\ngot:  %s\nwant: %s", got, exp)
+	}
+}
+
+// TestWindowsScoopZipLayout checks the scoop manifest points into the
+// directory the portable zip actually extracts to
+func TestWindowsScoopZipLayout(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.WindowsManifests.URL = "https://example.com/{{ .File }}"
+
+	b, err := LookupBuilder("windows", "zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err := b.Build(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.windowsScoop(artifacts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(p.OutDir, "scoop", "qri.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m scoopManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	arch := m.Architecture["64bit"]
+	if arch.Hash != artifacts[0].SHA256 {
+		t.Errorf("hash mismatch: %s", arch.Hash)
+	}
+	zr, err := zip.OpenReader(artifacts[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name == arch.ExtractDir+"/"+m.Bin {
+			return
+		}
+	}
+	t.Errorf("zip has no %s/%s", arch.ExtractDir, m.Bin)
+}
+
+func TestWindowsWinget(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.WindowsManifests.URL = "https://example.com/{{ .File }}"
+	p.MSI.Manufacturer = "Qri, Inc."
+	amd64 := writeTestArtifact(t, p, p.msiName(), "windows", "msi", "amd64")
+	p.MSI.Arch = "386"
+	x86 := writeTestArtifact(t, p, p.msiName(), "windows", "msi", "386")
+
+	if err := p.windowsWinget([]Artifact{amd64, x86}); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(p.OutDir, "winget", "manifests", "q", "QriInc", "qri", "0.5.0")
+	read := func(name string, doc interface{}) {
+		t.Helper()
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := yaml.UnmarshalStrict(data, doc); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+	}
+
+	var version wingetVersion
+	read("QriInc.qri.yaml", &version)
+	if version.PackageIdentifier != "QriInc.qri" || version.ManifestType != "version" {
+		t.Errorf("version manifest mismatch: %#v", version)
+	}
+
+	var installers wingetInstallers
+	read("QriInc.qri.installer.yaml", &installers)
+	if len(installers.Installers) != 2 {
+		t.Fatalf("expected an installer per architecture, got %d", len(installers.Installers))
+	}
+	for i, want := range []struct {
+		arch string
+		a    Artifact
+	}{{"x86", x86}, {"x64", amd64}} {
+		inst := installers.Installers[i]
+		if inst.Architecture != want.arch || inst.InstallerType != "wix" || inst.InstallerSha256 != strings.ToUpper(want.a.SHA256) {
+			t.Errorf("installer %d mismatch: %#v", i, inst)
+		}
+		if inst.InstallerURL != "https://example.com/"+filepath.Base(want.a.Path) {
+			t.Errorf("installer %d url mismatch: %s", i, inst.InstallerURL)
+		}
+	}
+
+	var locale wingetLocale
+	read("QriInc.qri.locale.en-US.yaml", &locale)
+	if locale.Publisher != "Qri, Inc." || locale.License != "GPL-3.0" || locale.Moniker != "qri" {
+		t.Errorf("locale manifest mismatch: %#v", locale)
+	}
+}
+
+func TestWingetID(t *testing.T) {
+	cases := []struct {
+		p    Package
+		want string
+	}{
+		{Package{BinName: "qri", WindowsManifests: WindowsManifestsConfig{Publisher: "Qri, Inc."}}, "QriInc.qri"},
+		{Package{BinName: "qri", WindowsManifests: WindowsManifestsConfig{WingetID: "Qri.Qri"}}, "Qri.Qri"},
+		{Package{Name: "Qri CLI", BinName: "qri"}, "QriCLI.qri"},
+	}
+	for _, c := range cases {
+		if got, err := c.p.wingetID(); err != nil || got != c.want {
+			t.Errorf("id mismatch. got: %q %v, want: %q", got, err, c.want)
+		}
+	}
+
+	for _, p := range []Package{
+		{BinName: "qri"},
+		{},
+		{WindowsManifests: WindowsManifestsConfig{WingetID: "Qri"}},
+		{WindowsManifests: WindowsManifestsConfig{WingetID: "Qri..qri"}},
+	} {
+		if id, err := p.wingetID(); err == nil {
+			t.Errorf("expected an error, got id %q", id)
+		}
+	}
+}
+
+func TestWindowsChocolatey(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.WindowsManifests.URL = "https://example.com/{{ .File }}"
+	msi := writeTestArtifact(t, p, p.msiName(), "windows", "msi", "amd64")
+
+	if err := p.windowsChocolatey([]Artifact{msi}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(filepath.Join(p.OutDir, "qri.0.5.0.nupkg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if len(zr.File) == 0 || zr.File[0].Name != "qri.nuspec" {
+		t.Fatalf("nupkg must begin with the nuspec")
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "tools/chocolateyinstall.ps1"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("nupkg missing %s", name)
+		}
+	}
+	for name, body := range files {
+		if strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".rels") || strings.HasSuffix(name, ".psmdcp") || strings.HasSuffix(name, ".nuspec") {
+			checkXML(t, name, body)
+		}
+	}
+
+	var spec nuspec
+	if err := xml.Unmarshal([]byte(files["qri.nuspec"]), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.Metadata.ID != "qri" || spec.Metadata.Version != "0.5.0" || spec.Metadata.Title != "Qri CLI" {
+		t.Errorf("nuspec mismatch: %#v", spec.Metadata)
+	}
+	install := files["tools/chocolateyinstall.ps1"]
+	for _, line := range []string{
+		"url64 = 'https://example.com/" + p.msiName() + "'",
+		"checksum64 = '" + msi.SHA256 + "'",
+	} {
+		if !strings.Contains(install, line) {
+			t.Errorf("install script missing %q:\n%s", line, install)
+		}
+	}
+	if strings.Contains(install, "  url = ") {
+		t.Errorf("install script has a 32 bit url without a 32 bit MSI:\n%s", install)
+	}
+}
+
+func TestPSString(t *testing.T) {
+	if got := psString("it's $env:x"); got != "'it''s $env:x'" {
+		t.Errorf("psString mismatch: %s", got)
+	}
+}
@@ -0,0 +1,146 @@
+package mkpkg
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ZipConfig encapsulates configuration details for creating a portable
+// windows zip, for users that can't run an installer
+type ZipConfig struct {
+	// Path to compatible windows binary executable to include
+	BinPath string
+	// target architecture using go's GOARCH naming, one of: 386, amd64.
+	// Default is the architecture mkpkg is running on
+	Arch string
+}
+
+// arch returns the configured GOARCH-style architecture, defaulting to the
+// architecture of the running process
+func (c ZipConfig) arch() string {
+	if c.Arch == "" {
+		return runtime.GOARCH
+	}
+	return c.Arch
+}
+
+// windowsZipName returns the base name shared by the zip and its top-level
+// directory, eg: qri-v0.5.0-windows-amd64
+func (p Package) windowsZipName() string {
+	return fmt.Sprintf("%s-%s-windows-%s", p.BinName, p.Version, p.Zip.arch())
+}
+
+func (p Package) windowsZip() (string, error) {
+	outDir, _, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	bin, err := ioutil.ReadFile(p.Zip.BinPath)
+	if err != nil {
+		return "", err
+	}
+
+	// scripts are rendered with values pre-quoted as powershell strings
+	data := map[string]string{
+		"Name":    psString(p.Name),
+		"BinName": psString(p.BinName),
+		"Exe":     psString(p.BinName + ext("windows")),
+	}
+	installPs1, err := renderTemplate(installPs1Tmpl, data)
+	if err != nil {
+		return "", err
+	}
+	uninstallPs1, err := renderTemplate(uninstallPs1Tmpl, data)
+	if err != nil {
+		return "", err
+	}
+
+	base := p.windowsZipName()
+	files := []archiveFile{
+		{Name: path.Join(base, p.BinName+ext("windows")), Mode: 0755, Body: bin},
+		{Name: path.Join(base, "install.ps1"), Mode: 0644, Body: []byte(installPs1)},
+		{Name: path.Join(base, "uninstall.ps1"), Mode: 0644, Body: []byte(uninstallPs1)},
+	}
+	if p.LicensePath != "" {
+		b, err := ioutil.ReadFile(p.LicensePath)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, archiveFile{Name: path.Join(base, "LICENSE"), Mode: 0644, Body: b})
+	}
+
+	f, err := os.Create(filepath.Join(outDir, base+".zip"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	now := time.Now()
+	for _, file := range withParentDirs(files) {
+		hdr := &zip.FileHeader{Name: file.Name, Method: zip.Deflate, Modified: now}
+		if file.Dir {
+			hdr.Name = strings.TrimSuffix(file.Name, "/") + "/"
+			hdr.Method = zip.Store
+		}
+		hdr.SetMode(os.FileMode(file.Mode))
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(file.Body); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// installPs1Tmpl copies the binary to %LOCALAPPDATA%\[BinName] and adds it to
+// the user PATH
+const installPs1Tmpl = `# install for the current user, no administrator rights required
+$ErrorActionPreference = 'Stop'
+
+$InstallDir = Join-Path $env:LOCALAPPDATA {{ .BinName }}
+New-Item -ItemType Directory -Force -Path $InstallDir | Out-Null
+Copy-Item -Force -Path (Join-Path $PSScriptRoot {{ .Exe }}) -Destination $InstallDir
+
+$UserPath = [Environment]::GetEnvironmentVariable('Path', 'User')
+$Parts = @($UserPath -split ';' | Where-Object { $_ })
+if ($Parts -notcontains $InstallDir) {
+  [Environment]::SetEnvironmentVariable('Path', (($Parts + $InstallDir) -join ';'), 'User')
+  $env:Path = "$env:Path;$InstallDir"
+}
+
+Write-Host ({{ .Name }} + ' installed to ' + $InstallDir + '. Open a new terminal to use ' + {{ .BinName }} + '.')
+`
+
+// uninstallPs1Tmpl removes the install directory and its user PATH entry
+const uninstallPs1Tmpl = `# uninstall for the current user
+$ErrorActionPreference = 'Stop'
+
+$InstallDir = Join-Path $env:LOCALAPPDATA {{ .BinName }}
+
+$UserPath = [Environment]::GetEnvironmentVariable('Path', 'User')
+$Parts = @($UserPath -split ';' | Where-Object { $_ -and $_ -ne $InstallDir })
+[Environment]::SetEnvironmentVariable('Path', ($Parts -join ';'), 'User')
+
+if (Test-Path $InstallDir) {
+  Remove-Item -Recurse -Force -Path $InstallDir
+}
+
+Write-Host ({{ .Name }} + ' uninstalled.')
+`
@@ -0,0 +1,125 @@
+package mkpkg
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWindowsZip(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path, err := p.windowsZip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(path); got != "qri-v0.5.0-windows-amd64.zip" {
+		t.Errorf("zip name mismatch: %s", got)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var names []string
+	files := map[string]string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+		if f.Name == "qri-v0.5.0-windows-amd64/qri.exe" && f.Mode().Perm() != 0755 {
+			t.Errorf("binary mode mismatch: %o", f.Mode().Perm())
+		}
+		if strings.HasSuffix(f.Name, "/") && !f.Mode().IsDir() {
+			t.Errorf("%s isn't a directory entry", f.Name)
+		}
+	}
+	want := "qri-v0.5.0-windows-amd64/,qri-v0.5.0-windows-amd64/LICENSE,qri-v0.5.0-windows-amd64/install.ps1,qri-v0.5.0-windows-amd64/qri.exe,qri-v0.5.0-windows-amd64/uninstall.ps1"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("entries mismatch.\ngot:  %s\nwant: %s", got, want)
+	}
+	if files["qri-v0.5.0-windows-amd64/qri.exe"] != testBin {
+		t.Errorf("binary body mismatch")
+	}
+
+	install := files["qri-v0.5.0-windows-amd64/install.ps1"]
+	for _, line := range []string{
+		"$InstallDir = Join-Path $env:LOCALAPPDATA 'qri'",
+		"Copy-Item -Force -Path (Join-Path $PSScriptRoot 'qri.exe') -Destination $InstallDir",
+		"Write-Host ('Qri CLI' + ' installed to '",
+	} {
+		if !strings.Contains(install, line) {
+			t.Errorf("install.ps1 missing %q:\n%s", line, install)
+		}
+	}
+	if !strings.Contains(files["qri-v0.5.0-windows-amd64/uninstall.ps1"], "Remove-Item -Recurse -Force -Path $InstallDir") {
+		t.Errorf("uninstall.ps1 doesn't remove the install directory")
+	}
+
+	pwsh, err := exec.LookPath("pwsh")
+	if err != nil {
+		t.Log("pwsh not found, skipping script parse checks")
+		return
+	}
+	dir := filepath.Dir(path)
+	for _, name := range []string{"install.ps1", "uninstall.ps1"} {
+		script := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(script, []byte(files["qri-v0.5.0-windows-amd64/"+name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		check := "$e = $null; [System.Management.Automation.Language.Parser]::ParseFile('" + script + "', [ref]$null, [ref]$e) | Out-Null; if ($e.Count) { $e; exit 1 }"
+		if out, err := exec.Command(pwsh, "-NoProfile", "-Command", check).CombinedOutput(); err != nil {
+			t.Errorf("%s has syntax errors: %s\n%s", name, err, out)
+		}
+	}
+}
+
+func TestWindowsZipQuoting(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Name = "Qri's CLI"
+	p.LicensePath = ""
+
+	path, err := p.windowsZip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/LICENSE") {
+			t.Errorf("zip has a LICENSE without LicensePath")
+		}
+		if !strings.HasSuffix(f.Name, "/install.ps1") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), "Write-Host ('Qri''s CLI' + ") {
+			t.Errorf("name isn't quoted for powershell:\n%s", b)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package mkpkg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// wixlMSI builds an MSI with msitools' wixl & wixl-heat, which run natively
+// on linux. wixl supports a subset of WiX, so the installer is rendered
+// from a simplified template without the WixUI dialog sequence
+func (p Package) wixlMSI() (string, error) {
+	outDir, version, err := p.environ()
+	if err != nil {
+		return "", err
+	}
+
+	arch, err := p.MSI.msArch()
+	if err != nil {
+		return "", err
+	}
+	programFiles := "ProgramFilesFolder"
+	if arch == "x64" {
+		programFiles = "ProgramFiles64Folder"
+	}
+
+	windowsData, err := p.windowsData(wixlWxsTmpl)
+	if err != nil {
+		return "", err
+	}
+
+	// Write out windows data that is used by the packaging process.
+	win, err := workDir("msi")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(win)
+	if err := writeDataFiles(windowsData, win); err != nil {
+		return "", err
+	}
+
+	appDir := filepath.Join(win, "app")
+	if err := p.stageWindowsApp(appDir, p.MSI.BinPath); err != nil {
+		return "", err
+	}
+
+	// Gather files. wixl-heat reads the list of paths to harvest on stdin
+	var paths []string
+	err = filepath.Walk(appDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(win, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	heatArgs := []string{
+		"--prefix", "app/",
+		"--component-group", "AppFiles",
+		"--directory-ref", "INSTALLDIR",
+		"--var", "var.SourceDir",
+	}
+	if arch == "x64" {
+		heatArgs = append(heatArgs, "--win64")
+	}
+	heat := exec.Command("wixl-heat", heatArgs...)
+	heat.Dir = win
+	heat.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+	heat.Stderr = os.Stderr
+	appfiles := &bytes.Buffer{}
+	heat.Stdout = appfiles
+	if err := heat.Run(); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(win, "AppFiles.wxs"), appfiles.Bytes(), 0644); err != nil {
+		return "", err
+	}
+
+	// Build package.
+	verMajor, verMinor, verPatch := wixVersion(version)
+
+	out := filepath.Join(outDir, p.msiName())
+	if err := runDir(win, "wixl",
+		"-a", arch,
+		"-D", "Version="+version,
+		"-D", fmt.Sprintf("WixVersion=%v.%v.%v", verMajor, verMinor, verPatch),
+		"-D", "Arch="+p.MSI.arch(),
+		"-D", "SourceDir=app",
+		"-D", "ProgramFilesFolder="+programFiles,
+		"-o", out,
+		"installer.wxs",
+		"AppFiles.wxs",
+	); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// wixlWxsTmpl is installer.wxs limited to the elements wixl understands
+var wixlWxsTmpl = `<?xml version="1.0" encoding="UTF-8"?>
+<Wix xmlns="http://schemas.microsoft.com/wix/2006/wi">
+
+<Product
+    Id="*"
+    Name="{{ .Name | html }} $(var.Arch) $(var.Version)"
+    Language="1033"
+    Version="$(var.WixVersion)"
+    Manufacturer="{{ .Manufacturer | html }}"
+    UpgradeCode="{{ .UpgradeCode }}" >
+
+<Package
+    Keywords='Installer'
+    Description="{{ .Name | html }} Installer"
+    Comments="{{ .Description | html }}"
+    InstallerVersion="200"
+    Compressed="yes"
+    InstallScope="perMachine"
+    Languages="1033" />
+
+<Property Id="ARPCOMMENTS" Value="{{ .Description | html }}" />
+{{- if .MSI.ARPContact }}
+<Property Id="ARPCONTACT" Value="{{ .MSI.ARPContact | html }}" />
+{{- end }}
+{{- if .MSI.ARPHelpLink }}
+<Property Id="ARPHELPLINK" Value="{{ .MSI.ARPHelpLink | html }}" />
+{{- end }}
+{{- if .SiteURL }}
+<Property Id="ARPREADME" Value="{{ .SiteURL | html }}" />
+<Property Id="ARPURLINFOABOUT" Value="{{ .SiteURL | html }}" />
+{{- end }}
+{{- if .MSI.IconPath }}
+<Icon Id="product.ico" SourceFile="images/product.ico"/>
+<Property Id="ARPPRODUCTICON" Value="product.ico" />
+{{- end }}
+<Media Id="1" Cabinet="{{ .BinName }}.cab" EmbedCab="yes" />
+<MajorUpgrade DowngradeErrorMessage="A newer version of {{ .Name | html }} is already installed." />
+
+<!-- Define the directory structure -->
+<Directory Id="TARGETDIR" Name="SourceDir">
+  <Directory Id="$(var.ProgramFilesFolder)">
+    <Directory Id="INSTALLDIR" Name="{{ .InstallDirName | html }}"/>
+  </Directory>
+  <Directory Id="ProgramMenuFolder">
+    <Directory Id="ProgramShortcutsDir" Name="{{ .Name | html }}"/>
+  </Directory>
+</Directory>
+
+<!-- Programs Menu Shortcuts -->
+<DirectoryRef Id="ProgramShortcutsDir">
+  <Component Id="Component_ProgramShortCuts" Guid="{{ .ShortcutsGUID }}">
+{{- range $i, $sc := .Shortcuts }}
+    <Shortcut
+        Id="StartMenuShortcut{{ $i }}"
+        Name="{{ $sc.Name | html }}"
+        Description="{{ $sc.Description | html }}"
+        {{- if $sc.Arguments }}
+        Arguments="{{ $sc.Arguments | html }}"
+        {{- end }}
+        {{- if $.MSI.IconPath }}
+        Icon="product.ico"
+        {{- end }}
+        Target="{{ $sc.Target | html }}" />
+{{- end }}
+    <RemoveFolder
+        Id="ProgramShortcutsDir"
+        On="uninstall" />
+    <RegistryValue
+        Root="HKCU"
+        Key="{{ .RegistryKey | html }}"
+        Name="ShortCuts"
+        Type="integer"
+        Value="1"
+        KeyPath="yes" />
+  </Component>
+</DirectoryRef>
+
+<!-- Registry & Environment Settings -->
+<DirectoryRef Id="INSTALLDIR">
+  <Component Id="Component_Environment" Guid="{{ .EnvGUID }}">
+    <RegistryValue
+        Root="HKCU"
+        Key="{{ .RegistryKey | html }}"
+        Name="installed"
+        Type="integer"
+        Value="1"
+        KeyPath="yes" />
+    <RegistryValue
+        Root="HKCU"
+        Key="{{ .RegistryKey | html }}"
+        Name="installLocation"
+        Type="string"
+        Value="[INSTALLDIR]" />
+{{- range $i, $env := .Environment }}
+    <Environment
+        Id="EnvironmentEntry{{ $i }}"
+        Action="set"
+        Part="{{ if $env.Part }}{{ $env.Part }}{{ else }}all{{ end }}"
+        Name="{{ $env.Name | html }}"
+        Permanent="no"
+        System="{{ if $env.System }}yes{{ else }}no{{ end }}"
+        Value="{{ $env.Value | html }}" />
+{{- end }}
+  </Component>
+</DirectoryRef>
+
+<!-- Install the files -->
+<Feature
+    Id="ProductFeature"
+    Title="{{ .Name | html }}"
+    Level="1">
+      <ComponentRef Id="Component_Environment" />
+      <ComponentGroupRef Id="AppFiles" />
+      <ComponentRef Id="Component_ProgramShortCuts" />
+</Feature>
+
+</Product>
+</Wix>
+`
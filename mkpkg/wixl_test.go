@@ -0,0 +1,69 @@
+package mkpkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestWixlWxs(t *testing.T) {
+	p, cleanup := testPackage(t)
+	defer cleanup()
+	p.Name = "Qri & Friends"
+	p.MSI.Shortcuts = []MSIShortcut{{Name: "Qri <Shell>", Arguments: `connect --setup "a"`}}
+
+	data, err := p.windowsData(wixlWxsTmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wxs := data["installer.wxs"]
+	checkXML(t, "installer.wxs", wxs)
+	for _, s := range []string{
+		`Name="Qri &amp; Friends $(var.Arch) $(var.Version)"`,
+		`<Directory Id="$(var.ProgramFilesFolder)">`,
+		`Arguments="connect --setup &#34;a&#34;"`,
+		`Target="[INSTALLDIR]bin\qri.exe"`,
+		`Value="[INSTALLDIR]bin" />`,
+	} {
+		if !strings.Contains(wxs, s) {
+			t.Errorf("installer.wxs missing %s", s)
+		}
+	}
+	// wixl doesn't support the WixUI extension
+	if strings.Contains(wxs, "UIRef") {
+		t.Errorf("wixl installer.wxs references WixUI")
+	}
+}
+
+func TestWixlMSI(t *testing.T) {
+	if _, err := exec.LookPath("wixl"); err != nil {
+		t.Skip("wixl not found")
+	}
+	p, cleanup := testPackage(t)
+	defer cleanup()
+
+	path, err := p.wixlMSI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MSIs are OLE compound documents
+	if !bytes.HasPrefix(data, []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}) {
+		t.Errorf("%s isn't a compound document", path)
+	}
+	if _, err := exec.LookPath("msiinfo"); err != nil {
+		return
+	}
+	out, err := exec.Command("msiinfo", "export", path, "Property").CombinedOutput()
+	if err != nil {
+		t.Fatalf("msiinfo: %s\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte("ProductVersion\t0.5.0")) {
+		t.Errorf("expected ProductVersion 0.5.0:\n%s", out)
+	}
+}
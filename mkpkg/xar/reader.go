@@ -0,0 +1,347 @@
+package xar
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File is a single file or directory within an archive
+type File struct {
+	FileHeader
+	// uncompressed size of the file
+	Size int64
+	// checksums of uncompressed & archived data, as hex strings
+	ExtractedChecksum string
+	ArchivedChecksum  string
+	// checksum algorithm used for this file
+	Checksum Checksum
+
+	r      *Reader
+	offset int64
+	length int64
+}
+
+// Reader reads the contents of a xar archive
+type Reader struct {
+	// every file & directory in the archive, parents before children
+	File []*File
+	// algorithm used to checksum the table of contents
+	Checksum Checksum
+	// signature algorithm, empty if the archive has no signature
+	SignatureStyle string
+	// DER-encoded certificates accompanying the signature, leaf first
+	Certificates [][]byte
+
+	r        io.ReaderAt
+	heapBase int64
+	heapSize int64
+	sig      *tocSignature
+	tocSum   []byte
+}
+
+// NewReader reads a xar archive from r, which has the given size. The
+// table of contents checksum is verified before returning
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	hdr := make([]byte, headerSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("xar: reading header: %s", err)
+	}
+	if binary.BigEndian.Uint32(hdr[0:4]) != magic {
+		return nil, errors.New("xar: not a xar archive")
+	}
+	hdrSize := int64(binary.BigEndian.Uint16(hdr[4:6]))
+	if version := binary.BigEndian.Uint16(hdr[6:8]); version != 1 {
+		return nil, fmt.Errorf("xar: unsupported version %d", version)
+	}
+	if hdrSize < headerSize || hdrSize > size {
+		return nil, fmt.Errorf("xar: invalid header size %d", hdrSize)
+	}
+	// compare as unsigned so lengths that overflow int64 are rejected too
+	tocLen := binary.BigEndian.Uint64(hdr[8:16])
+	if tocLen == 0 || tocLen > uint64(size-hdrSize) {
+		return nil, fmt.Errorf("xar: invalid table of contents length %d", tocLen)
+	}
+	tocSize := binary.BigEndian.Uint64(hdr[16:24])
+
+	var checksum Checksum
+	switch binary.BigEndian.Uint32(hdr[24:28]) {
+	case cksumNone:
+		return nil, errors.New("xar: archives without checksums are not supported")
+	case cksumSHA1:
+		checksum = SHA1
+	case cksumMD5:
+		checksum = MD5
+	case cksumOther:
+		checksum = SHA256
+		if hdrSize > headerSize {
+			name := make([]byte, hdrSize-headerSize)
+			if _, err := r.ReadAt(name, headerSize); err != nil {
+				return nil, fmt.Errorf("xar: reading header: %s", err)
+			}
+			checksum = Checksum(strings.TrimRight(string(name), "\x00"))
+		}
+	default:
+		return nil, errors.New("xar: unknown checksum algorithm")
+	}
+
+	ztoc := make([]byte, int64(tocLen))
+	if _, err := r.ReadAt(ztoc, hdrSize); err != nil {
+		return nil, fmt.Errorf("xar: reading table of contents: %s", err)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(ztoc))
+	if err != nil {
+		return nil, fmt.Errorf("xar: decompressing table of contents: %s", err)
+	}
+	// read at most one byte past the uncompressed length in the header, so
+	// a small archive can't inflate to an unbounded table of contents
+	tocXML, err := ioutil.ReadAll(io.LimitReader(zr, int64(tocSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("xar: decompressing table of contents: %s", err)
+	}
+	if uint64(len(tocXML)) != tocSize {
+		return nil, fmt.Errorf("xar: table of contents is not the %d bytes the header gives", tocSize)
+	}
+	doc := &tocXar{}
+	if err := xml.Unmarshal(tocXML, doc); err != nil {
+		return nil, fmt.Errorf("xar: decoding table of contents: %s", err)
+	}
+
+	xr := &Reader{
+		Checksum: checksum,
+		r:        r,
+		heapBase: hdrSize + int64(tocLen),
+		heapSize: size - hdrSize - int64(tocLen),
+	}
+
+	// verify the stored toc checksum
+	h, err := checksum.newHash()
+	if err != nil {
+		return nil, err
+	}
+	h.Write(ztoc)
+	xr.tocSum = h.Sum(nil)
+	stored, err := xr.heap(doc.TOC.Checksum.Offset, doc.TOC.Checksum.Size)
+	if err != nil {
+		return nil, fmt.Errorf("xar: reading checksum: %s", err)
+	}
+	if !bytes.Equal(stored, xr.tocSum) {
+		return nil, errors.New("xar: table of contents checksum mismatch")
+	}
+
+	if sig := doc.TOC.Signature; sig != nil {
+		if err := xr.checkHeap(sig.Offset, sig.Size); err != nil {
+			return nil, fmt.Errorf("xar: signature %s", err)
+		}
+		xr.sig = sig
+		xr.SignatureStyle = sig.Style
+		var certs []string
+		if sig.KeyInfo != nil {
+			certs = sig.KeyInfo.Certificates
+		}
+		for _, c := range certs {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(c), ""))
+			if err != nil {
+				return nil, fmt.Errorf("xar: decoding certificate: %s", err)
+			}
+			xr.Certificates = append(xr.Certificates, der)
+		}
+	}
+
+	if err := xr.addFiles("", doc.TOC.Files); err != nil {
+		return nil, err
+	}
+	return xr, nil
+}
+
+// ReadCloser is a Reader that must be closed when no longer needed
+type ReadCloser struct {
+	Reader
+	f *os.File
+}
+
+// OpenReader opens the named xar archive for reading
+func OpenReader(name string) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	xr, err := NewReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &ReadCloser{Reader: *xr, f: f}, nil
+}
+
+// Close closes the underlying archive file
+func (rc *ReadCloser) Close() error {
+	return rc.f.Close()
+}
+
+// TOCChecksum returns the checksum of the compressed table of contents,
+// which is the data an archive signature signs
+func (r *Reader) TOCChecksum() []byte {
+	return r.tocSum
+}
+
+// Signature returns the signature bytes stored in the heap, or nil if the
+// archive has no signature. Unsigned archives with reserved signature space
+// return zeros
+func (r *Reader) Signature() ([]byte, error) {
+	if r.sig == nil {
+		return nil, nil
+	}
+	return r.heap(r.sig.Offset, r.sig.Size)
+}
+
+// SignatureOffset returns the absolute offset of the reserved signature
+// space within the archive file, so it can be filled in after signing. It
+// returns -1 if no space is reserved
+func (r *Reader) SignatureOffset() int64 {
+	if r.sig == nil {
+		return -1
+	}
+	return r.heapBase + r.sig.Offset
+}
+
+// ReadFile returns the uncompressed contents of the named file
+func (r *Reader) ReadFile(name string) ([]byte, error) {
+	name = path.Clean(name)
+	for _, f := range r.File {
+		if f.Name == name {
+			return f.ReadAll()
+		}
+	}
+	return nil, fmt.Errorf("xar: file not found: %s", name)
+}
+
+// ReadAll reads and decompresses the contents of the file, verifying both
+// archived & extracted checksums
+func (f *File) ReadAll() ([]byte, error) {
+	if f.IsDir() {
+		return nil, fmt.Errorf("xar: %s is a directory", f.Name)
+	}
+	archived, err := f.r.heap(f.offset, f.length)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.verify(archived, f.ArchivedChecksum); err != nil {
+		return nil, fmt.Errorf("xar: %s: archived %s", f.Name, err)
+	}
+
+	data := archived
+	switch f.Encoding {
+	case EncodingGzip:
+		zr, err := zlib.NewReader(bytes.NewReader(archived))
+		if err != nil {
+			return nil, fmt.Errorf("xar: %s: %s", f.Name, err)
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("xar: %s: %s", f.Name, err)
+		}
+	case EncodingNone, "":
+	default:
+		return nil, fmt.Errorf("xar: %s: unsupported encoding: %s", f.Name, f.Encoding)
+	}
+
+	if err := f.verify(data, f.ExtractedChecksum); err != nil {
+		return nil, fmt.Errorf("xar: %s: extracted %s", f.Name, err)
+	}
+	return data, nil
+}
+
+func (f *File) verify(data []byte, sum string) error {
+	if sum == "" {
+		return nil
+	}
+	h, err := f.Checksum.newHash()
+	if err != nil {
+		return err
+	}
+	h.Write(data)
+	if hex.EncodeToString(h.Sum(nil)) != strings.ToLower(strings.TrimSpace(sum)) {
+		return errors.New("checksum mismatch")
+	}
+	return nil
+}
+
+// checkHeap returns an error if a region doesn't lie within the heap
+func (r *Reader) checkHeap(offset, length int64) error {
+	if offset < 0 || length < 0 || offset > r.heapSize || length > r.heapSize-offset {
+		return fmt.Errorf("data at offset %d, length %d exceeds the %d byte heap", offset, length, r.heapSize)
+	}
+	return nil
+}
+
+// heap reads a region of the heap, which is checked to lie within the
+// archive before anything is allocated
+func (r *Reader) heap(offset, length int64) ([]byte, error) {
+	if err := r.checkHeap(offset, length); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := r.r.ReadAt(buf, r.heapBase+offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// addFiles flattens the table of contents tree into r.File
+func (r *Reader) addFiles(dir string, files []*tocFile) error {
+	for _, tf := range files {
+		name := path.Join(dir, tf.Name)
+		mode, _ := strconv.ParseUint(tf.Mode, 8, 32)
+		f := &File{
+			FileHeader: FileHeader{
+				Name:  name,
+				Mode:  os.FileMode(mode),
+				UID:   tf.UID,
+				GID:   tf.GID,
+				User:  tf.User,
+				Group: tf.Group,
+			},
+			r: r,
+		}
+		if t, err := time.Parse(timeFormat, tf.Mtime); err == nil {
+			f.ModTime = t
+		}
+		if tf.Type == "directory" {
+			f.Mode |= os.ModeDir
+		}
+		if tf.Data != nil {
+			if err := r.checkHeap(tf.Data.Offset, tf.Data.Length); err != nil {
+				return fmt.Errorf("xar: %s: %s", name, err)
+			}
+			f.Size = tf.Data.Size
+			f.Encoding = Encoding(tf.Data.Encoding.Style)
+			f.ExtractedChecksum = tf.Data.ExtractedChecksum.Digest
+			f.ArchivedChecksum = tf.Data.ArchivedChecksum.Digest
+			f.Checksum = Checksum(tf.Data.ExtractedChecksum.Style)
+			f.offset = tf.Data.Offset
+			f.length = tf.Data.Length
+		}
+		r.File = append(r.File, f)
+		if err := r.addFiles(name, tf.Files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package xar
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriterOptions configures a Writer
+type WriterOptions struct {
+	// algorithm for the table of contents & file checksums. Default is SHA1
+	Checksum Checksum
+	// bytes of heap space to reserve for a signature of the table of contents
+	// checksum, eg: 256 for an RSA-2048 signature. zero reserves no space
+	SignatureSize int
+	// signature algorithm recorded in the table of contents. Default is RSA
+	SignatureStyle string
+	// DER-encoded signing certificate chain, leaf first
+	Certificates [][]byte
+}
+
+// Writer creates a xar archive. The table of contents must precede file
+// data, so data is buffered until Close is called
+type Writer struct {
+	w     io.Writer
+	opts  WriterOptions
+	toc   toc
+	heap  *bytes.Buffer
+	dirs  map[string]*tocFile
+	names map[string]bool
+	id    int
+}
+
+// NewWriter creates a xar Writer that writes to w
+func NewWriter(w io.Writer, opts WriterOptions) (*Writer, error) {
+	if opts.Checksum == "" {
+		opts.Checksum = SHA1
+	}
+	if opts.Checksum != SHA1 && opts.Checksum != SHA256 {
+		return nil, fmt.Errorf("xar: cannot write %s checksums", opts.Checksum)
+	}
+	if opts.SignatureStyle == "" {
+		opts.SignatureStyle = "RSA"
+	}
+
+	h, _ := opts.Checksum.newHash()
+	xw := &Writer{
+		w:     w,
+		opts:  opts,
+		heap:  &bytes.Buffer{},
+		dirs:  map[string]*tocFile{},
+		names: map[string]bool{},
+	}
+	xw.toc.CreationTime = strings.TrimSuffix(time.Now().UTC().Format(timeFormat), "Z")
+	xw.toc.Checksum = tocChecksum{Style: string(opts.Checksum), Offset: 0, Size: int64(h.Size())}
+
+	// heap begins with the toc checksum, followed by signature space
+	xw.heap.Write(make([]byte, h.Size()))
+	if opts.SignatureSize > 0 {
+		sig := &tocSignature{Style: opts.SignatureStyle, Offset: int64(xw.heap.Len()), Size: int64(opts.SignatureSize)}
+		if len(opts.Certificates) > 0 {
+			sig.KeyInfo = &tocKeyInfo{}
+			for _, cert := range opts.Certificates {
+				sig.KeyInfo.Certificates = append(sig.KeyInfo.Certificates, base64.StdEncoding.EncodeToString(cert))
+			}
+		}
+		xw.toc.Signature = sig
+		xw.heap.Write(make([]byte, opts.SignatureSize))
+	}
+	return xw, nil
+}
+
+// Mkdir adds a directory to the archive. Parent directories of files are
+// created automatically, Mkdir is only needed to set directory details or
+// add empty directories. Details of directories that were already created
+// are replaced by hdr
+func (w *Writer) Mkdir(hdr FileHeader) error {
+	hdr.Mode |= os.ModeDir
+	name := path.Clean(hdr.Name)
+	if d, ok := w.dirs[name]; ok {
+		setHeader(d, hdr)
+		return nil
+	}
+	_, err := w.dir(name, &hdr)
+	return err
+}
+
+// WriteFile adds a file with the given contents to the archive
+func (w *Writer) WriteFile(hdr FileHeader, body []byte) error {
+	name := path.Clean(hdr.Name)
+	if w.names[name] {
+		return fmt.Errorf("xar: duplicate file: %s", name)
+	}
+	if hdr.Encoding == "" {
+		hdr.Encoding = EncodingGzip
+	}
+
+	archived := body
+	switch hdr.Encoding {
+	case EncodingGzip:
+		buf := &bytes.Buffer{}
+		zw := zlib.NewWriter(buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		archived = buf.Bytes()
+	case EncodingNone:
+	default:
+		return fmt.Errorf("xar: unsupported encoding: %s", hdr.Encoding)
+	}
+
+	parent, err := w.dir(path.Dir(name), nil)
+	if err != nil {
+		return err
+	}
+
+	entry := w.entry(name, "file", hdr)
+	entry.Data = &tocData{
+		Length:            int64(len(archived)),
+		Offset:            int64(w.heap.Len()),
+		Size:              int64(len(body)),
+		Encoding:          tocStyle{Style: string(hdr.Encoding)},
+		ExtractedChecksum: tocDigest{Style: string(w.opts.Checksum), Digest: w.sum(body)},
+		ArchivedChecksum:  tocDigest{Style: string(w.opts.Checksum), Digest: w.sum(archived)},
+	}
+	w.heap.Write(archived)
+	w.append(parent, entry)
+	return nil
+}
+
+// Close writes the header, table of contents and heap to the underlying
+// writer. It does not close the underlying writer
+func (w *Writer) Close() error {
+	tocXML, err := xml.MarshalIndent(tocXar{TOC: w.toc}, "", " ")
+	if err != nil {
+		return err
+	}
+	tocXML = append([]byte(xml.Header), tocXML...)
+
+	ztoc := &bytes.Buffer{}
+	zw := zlib.NewWriter(ztoc)
+	if _, err := zw.Write(tocXML); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	h, _ := w.opts.Checksum.newHash()
+	h.Write(ztoc.Bytes())
+	heap := w.heap.Bytes()
+	copy(heap, h.Sum(nil))
+
+	hdr := &bytes.Buffer{}
+	size, alg := headerSize, uint32(cksumSHA1)
+	if w.opts.Checksum != SHA1 {
+		// other checksums are named in a 36 byte field following the header
+		size, alg = headerSize+36, cksumOther
+	}
+	binary.Write(hdr, binary.BigEndian, uint32(magic))
+	binary.Write(hdr, binary.BigEndian, uint16(size))
+	binary.Write(hdr, binary.BigEndian, uint16(1))
+	binary.Write(hdr, binary.BigEndian, uint64(ztoc.Len()))
+	binary.Write(hdr, binary.BigEndian, uint64(len(tocXML)))
+	binary.Write(hdr, binary.BigEndian, alg)
+	if alg == cksumOther {
+		name := make([]byte, 36)
+		copy(name, w.opts.Checksum)
+		hdr.Write(name)
+	}
+
+	for _, chunk := range [][]byte{hdr.Bytes(), ztoc.Bytes(), heap} {
+		if _, err := w.w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dir returns the directory entry for name, creating it and any parents if
+// they don't exist. the archive root is nil
+func (w *Writer) dir(name string, hdr *FileHeader) (*tocFile, error) {
+	if name == "." || name == "/" {
+		return nil, nil
+	}
+	if d, ok := w.dirs[name]; ok {
+		return d, nil
+	}
+	if w.names[name] {
+		return nil, fmt.Errorf("xar: %s is not a directory", name)
+	}
+	parent, err := w.dir(path.Dir(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	if hdr == nil {
+		hdr = &FileHeader{Mode: os.ModeDir | 0755}
+	}
+	d := w.entry(name, "directory", *hdr)
+	w.dirs[name] = d
+	w.append(parent, d)
+	return d, nil
+}
+
+// entry creates a table of contents entry, applying default ownership
+func (w *Writer) entry(name, typ string, hdr FileHeader) *tocFile {
+	w.id++
+	w.names[name] = true
+	f := &tocFile{ID: w.id, Type: typ, Name: path.Base(name)}
+	setHeader(f, hdr)
+	return f
+}
+
+// setHeader sets ownership, mode & modification time of an entry
+func setHeader(f *tocFile, hdr FileHeader) {
+	if hdr.User == "" {
+		hdr.User = "root"
+	}
+	if hdr.Group == "" {
+		hdr.Group = "wheel"
+	}
+	if hdr.ModTime.IsZero() {
+		hdr.ModTime = time.Now()
+	}
+	f.Mtime = hdr.ModTime.UTC().Format(timeFormat)
+	f.Group = hdr.Group
+	f.GID = hdr.GID
+	f.User = hdr.User
+	f.UID = hdr.UID
+	f.Mode = "0" + strconv.FormatInt(int64(hdr.Mode.Perm()), 8)
+}
+
+func (w *Writer) append(parent, entry *tocFile) {
+	if parent == nil {
+		w.toc.Files = append(w.toc.Files, entry)
+		return
+	}
+	parent.Files = append(parent.Files, entry)
+}
+
+func (w *Writer) sum(data []byte) string {
+	h, _ := w.opts.Checksum.newHash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
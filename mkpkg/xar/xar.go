@@ -0,0 +1,150 @@
+// Package xar reads and writes xar (eXtensible ARchive) files, the container
+// format of flat macOS installer packages
+package xar
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"os"
+	"time"
+)
+
+// magic number that opens every xar archive: "xar!"
+const magic = 0x78617221
+
+// headerSize is the size of a xar header using a named checksum algorithm
+const headerSize = 28
+
+// Checksum identifies a hashing algorithm for archive & file checksums
+type Checksum string
+
+const (
+	// SHA1 is the default checksum, and the only one older tools understand
+	SHA1 Checksum = "sha1"
+	// SHA256 checksums are used by modern versions of macOS
+	SHA256 Checksum = "sha256"
+	// MD5 checksums can be read, but not written
+	MD5 Checksum = "md5"
+)
+
+// header checksum algorithm identifiers
+const (
+	cksumNone  = 0
+	cksumSHA1  = 1
+	cksumMD5   = 2
+	cksumOther = 3
+)
+
+// newHash returns a hash for the checksum algorithm
+func (c Checksum) newHash() (hash.Hash, error) {
+	switch c {
+	case SHA1, "":
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case MD5:
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("xar: unsupported checksum algorithm: %s", c)
+	}
+}
+
+// Encoding is the compression applied to file data within the heap
+type Encoding string
+
+const (
+	// EncodingGzip compresses data with zlib. xar calls this "gzip"
+	EncodingGzip Encoding = "application/x-gzip"
+	// EncodingNone stores data uncompressed
+	EncodingNone Encoding = "application/octet-stream"
+)
+
+// FileHeader describes a file within a xar archive
+type FileHeader struct {
+	// slash-separated path of the file within the archive
+	Name string
+	// permission bits and directory flag of the file
+	Mode os.FileMode
+	// last modification time
+	ModTime time.Time
+	// owner details. default to root:wheel
+	UID, GID    int
+	User, Group string
+	// compression to apply to file data. Default is EncodingGzip
+	Encoding Encoding
+}
+
+// IsDir reports if the header describes a directory
+func (h FileHeader) IsDir() bool {
+	return h.Mode.IsDir()
+}
+
+// timeFormat is the layout of timestamps in the table of contents
+const timeFormat = "2006-01-02T15:04:05Z"
+
+// table of contents xml structures
+type tocXar struct {
+	XMLName xml.Name `xml:"xar"`
+	TOC     toc      `xml:"toc"`
+}
+
+type toc struct {
+	Checksum     tocChecksum   `xml:"checksum"`
+	Signature    *tocSignature `xml:"signature,omitempty"`
+	CreationTime string        `xml:"creation-time"`
+	Files        []*tocFile    `xml:"file"`
+}
+
+type tocChecksum struct {
+	Style  string `xml:"style,attr"`
+	Offset int64  `xml:"offset"`
+	Size   int64  `xml:"size"`
+}
+
+type tocSignature struct {
+	Style   string      `xml:"style,attr"`
+	Offset  int64       `xml:"offset"`
+	Size    int64       `xml:"size"`
+	KeyInfo *tocKeyInfo `xml:"KeyInfo,omitempty"`
+}
+
+type tocKeyInfo struct {
+	XMLName      xml.Name `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+	Certificates []string `xml:"X509Data>X509Certificate"`
+}
+
+type tocFile struct {
+	ID    int        `xml:"id,attr"`
+	Data  *tocData   `xml:"data,omitempty"`
+	Mtime string     `xml:"mtime,omitempty"`
+	Group string     `xml:"group,omitempty"`
+	GID   int        `xml:"gid"`
+	User  string     `xml:"user,omitempty"`
+	UID   int        `xml:"uid"`
+	Mode  string     `xml:"mode,omitempty"`
+	Type  string     `xml:"type"`
+	Name  string     `xml:"name"`
+	Files []*tocFile `xml:"file"`
+}
+
+type tocData struct {
+	Length            int64     `xml:"length"`
+	Offset            int64     `xml:"offset"`
+	Size              int64     `xml:"size"`
+	Encoding          tocStyle  `xml:"encoding"`
+	ExtractedChecksum tocDigest `xml:"extracted-checksum"`
+	ArchivedChecksum  tocDigest `xml:"archived-checksum"`
+}
+
+type tocStyle struct {
+	Style string `xml:"style,attr"`
+}
+
+type tocDigest struct {
+	Style  string `xml:"style,attr"`
+	Digest string `xml:",chardata"`
+}
@@ -0,0 +1,236 @@
+package xar
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	modTime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	files := []struct {
+		hdr  FileHeader
+		body string
+	}{
+		{FileHeader{Name: "Distribution", Mode: 0644, ModTime: modTime}, "<installer-gui-script/>"},
+		{FileHeader{Name: "io.qri.cli.pkg/Payload", Mode: 0644, ModTime: modTime, Encoding: EncodingNone}, "payload bytes"},
+		{FileHeader{Name: "io.qri.cli.pkg/Bom", Mode: 0600, ModTime: modTime}, strings.Repeat("bom", 1000)},
+	}
+
+	for _, checksum := range []Checksum{SHA1, SHA256} {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, WriterOptions{Checksum: checksum, SignatureSize: 256, Certificates: [][]byte{[]byte("cert")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Mkdir(FileHeader{Name: "Resources", Mode: 0700, ModTime: modTime}); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			if err := w.WriteFile(f.hdr, []byte(f.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.WriteFile(files[0].hdr, nil); err == nil {
+			t.Errorf("%s: expected duplicate file error", checksum)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("%s: %s", checksum, err)
+		}
+		if r.Checksum != checksum {
+			t.Errorf("checksum mismatch. got: %s, want: %s", r.Checksum, checksum)
+		}
+		var names []string
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+		if got, want := strings.Join(names, ","), "Resources,Distribution,io.qri.cli.pkg,io.qri.cli.pkg/Payload,io.qri.cli.pkg/Bom"; got != want {
+			t.Errorf("%s: names mismatch.\ngot:  %s\nwant: %s", checksum, got, want)
+		}
+		if !r.File[0].IsDir() || r.File[0].Mode.Perm() != 0700 {
+			t.Errorf("%s: directory mode mismatch: %s", checksum, r.File[0].Mode)
+		}
+		for _, f := range files {
+			got, err := r.ReadFile(f.hdr.Name)
+			if err != nil {
+				t.Fatalf("%s: %s", checksum, err)
+			}
+			if string(got) != f.body {
+				t.Errorf("%s: %s body mismatch", checksum, f.hdr.Name)
+			}
+		}
+		bom := r.File[4]
+		if bom.Mode.Perm() != 0600 || !bom.ModTime.Equal(modTime) || bom.User != "root" || bom.Group != "wheel" {
+			t.Errorf("%s: header mismatch: %#v", checksum, bom.FileHeader)
+		}
+		if bom.Encoding != EncodingGzip || bom.Size != 3000 {
+			t.Errorf("%s: expected 3000 byte gzip file, got %d byte %s", checksum, bom.Size, bom.Encoding)
+		}
+
+		if r.SignatureStyle != "RSA" || len(r.Certificates) != 1 || string(r.Certificates[0]) != "cert" {
+			t.Errorf("%s: signature details mismatch", checksum)
+		}
+		sig, err := r.Signature()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sig) != 256 || !bytes.Equal(sig, make([]byte, 256)) {
+			t.Errorf("%s: expected 256 zero bytes of reserved signature space", checksum)
+		}
+		if off := r.SignatureOffset(); off+256 > int64(buf.Len()) {
+			t.Errorf("%s: signature offset %d is outside the archive", checksum, off)
+		}
+	}
+}
+
+func TestMkdirExisting(t *testing.T) {
+	modTime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile(FileHeader{Name: "dir/file"}, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	// dir was created for file, Mkdir replaces its details
+	if err := w.Mkdir(FileHeader{Name: "dir", Mode: 0700, User: "qri", ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Mkdir(FileHeader{Name: "dir/file"}); err == nil {
+		t.Error("expected an error making a directory over a file")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != 2 {
+		t.Fatalf("expected dir & file, got %d entries", len(r.File))
+	}
+	dir := r.File[0]
+	if dir.Name != "dir" || !dir.IsDir() || dir.Mode.Perm() != 0700 || dir.User != "qri" || !dir.ModTime.Equal(modTime) {
+		t.Errorf("directory header mismatch: %#v", dir.FileHeader)
+	}
+}
+
+func TestReadCorrupted(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile(FileHeader{Name: "file"}, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// flip the final byte of the heap, which belongs to the file
+	data := append([]byte{}, buf.Bytes()...)
+	data[len(data)-1] ^= 0xff
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadFile("file"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got: %v", err)
+	}
+
+	// flip a byte of the stored toc checksum
+	data = append([]byte{}, buf.Bytes()...)
+	tocLen := binary.BigEndian.Uint64(data[8:16])
+	data[headerSize+int(tocLen)] ^= 0xff
+	if _, err := NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Errorf("expected toc checksum error")
+	}
+}
+
+// testHeader builds a sha1 xar header
+func testHeader(hdrSize uint16, tocLen uint64) []byte {
+	hdr := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(hdr, magic)
+	binary.BigEndian.PutUint16(hdr[4:], hdrSize)
+	binary.BigEndian.PutUint16(hdr[6:], 1)
+	binary.BigEndian.PutUint64(hdr[8:], tocLen)
+	binary.BigEndian.PutUint32(hdr[24:], cksumSHA1)
+	return hdr
+}
+
+// testArchive builds a sha1 archive from a table of contents & heap, with
+// the toc checksum filled in at the start of the heap
+func testArchive(t *testing.T, tocXML string, heap []byte) []byte {
+	t.Helper()
+	ztoc := &bytes.Buffer{}
+	zw := zlib.NewWriter(ztoc)
+	zw.Write([]byte(tocXML))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(ztoc.Bytes())
+	hdr := testHeader(headerSize, uint64(ztoc.Len()))
+	binary.BigEndian.PutUint64(hdr[16:], uint64(len(tocXML)))
+	data := append(hdr, ztoc.Bytes()...)
+	data = append(data, sum[:]...)
+	return append(data, heap...)
+}
+
+func TestReadMalformed(t *testing.T) {
+	const tocChecksum = `<checksum style="sha1"><offset>0</offset><size>20</size></checksum>`
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("zip!"), testHeader(headerSize, 1)[4:]...)},
+		{"short header size", append(testHeader(4, 1), 0)},
+		{"header size past end", testHeader(0xffff, 1)},
+		{"zero toc length", append(testHeader(headerSize, 0), 0)},
+		{"toc length past end", append(testHeader(headerSize, 100), 0)},
+		{"toc length overflows", append(testHeader(headerSize, 1<<63+1), 0)},
+		{"toc length max", append(testHeader(headerSize, 1<<64-1), 0)},
+		{"toc checksum past heap", testArchive(t, `<xar><toc><checksum style="sha1"><offset>10</offset><size>20</size></checksum></toc></xar>`, nil)},
+		{"huge toc checksum", testArchive(t, `<xar><toc><checksum style="sha1"><offset>0</offset><size>9223372036854775807</size></checksum></toc></xar>`, nil)},
+		{"negative toc checksum", testArchive(t, `<xar><toc><checksum style="sha1"><offset>-20</offset><size>20</size></checksum></toc></xar>`, nil)},
+		{"huge signature", testArchive(t, `<xar><toc>`+tocChecksum+`<signature style="RSA"><offset>20</offset><size>1099511627776</size></signature></toc></xar>`, nil)},
+		{"huge file", testArchive(t, `<xar><toc>`+tocChecksum+`<file id="1"><data><length>1099511627776</length><offset>20</offset><size>1</size></data><type>file</type><name>f</name></file></toc></xar>`, nil)},
+		{"file offset overflows", testArchive(t, `<xar><toc>`+tocChecksum+`<file id="1"><data><length>10</length><offset>9223372036854775800</offset><size>1</size></data><type>file</type><name>f</name></file></toc></xar>`, make([]byte, 10))},
+	}
+	// the inflated toc must be exactly the size the header gives
+	for name, size := range map[string]uint64{"toc longer than header size": 10, "toc shorter than header size": 1 << 20} {
+		data := testArchive(t, `<xar><toc>`+tocChecksum+`</toc></xar>`, nil)
+		binary.BigEndian.PutUint64(data[16:], size)
+		cases = append(cases, struct {
+			name string
+			data []byte
+		}{name, data})
+	}
+	for _, c := range cases {
+		if _, err := NewReader(bytes.NewReader(c.data), int64(len(c.data))); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+
+	// a file within the heap reads fine
+	data := testArchive(t, `<xar><toc>`+tocChecksum+`<file id="1"><data><length>5</length><offset>20</offset><size>5</size><encoding style="application/octet-stream"/></data><type>file</type><name>f</name></file></toc></xar>`, []byte("hello"))
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := r.ReadFile("f"); err != nil || string(body) != "hello" {
+		t.Errorf("expected hello, got: %q %v", body, err)
+	}
+}